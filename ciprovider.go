@@ -0,0 +1,31 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package dd_sdk_go_testing
+
+import "github.com/DataDog/dd-sdk-go-testing/internal/utils"
+
+// RegisterCIProvider registers a custom CI provider, detected when the environment variable
+// detectEnvKey is set, whose tags are returned by extract, e.g. ci.pipeline.id. It takes precedence
+// over the built-in providers. The tags are normalized and overridden by the DD_GIT_* environment
+// variables like the ones of the built-in providers. It must be called before Run.
+func RegisterCIProvider(detectEnvKey string, extract func() map[string]string) {
+	utils.RegisterProvider(detectEnvKey, extract)
+}
+
+// LoadCIProviderConfig registers the custom CI provider configured in the YAML file at path, which
+// maps the tags to the environment variables holding their value:
+//
+//	detect: MY_CI
+//	name: my-ci
+//	tags:
+//	  ci.pipeline.id: MY_CI_RUN_ID
+//	  ci.pipeline.url: MY_CI_RUN_URL
+//
+// The file can also be set in the DD_CIVISIBILITY_CI_PROVIDER_CONFIG environment variable. It must be
+// called before Run.
+func LoadCIProviderConfig(path string) error {
+	return utils.LoadProviderConfig(path)
+}
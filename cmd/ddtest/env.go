@@ -0,0 +1,127 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/utils"
+)
+
+// envReport is the metadata detected by the SDK, with how it was detected.
+type envReport struct {
+	Tags map[string]string `json:"tags"`
+	*utils.Diagnostics
+	// NotInSpec are the tags detected that are not in the spec.
+	NotInSpec []string `json:"not_in_spec,omitempty"`
+}
+
+// runEnv prints the tags the SDK detects from the CI provider, the local git repository and the
+// environment, with their source, and validates them against the spec.
+func runEnv(args []string) error {
+	flags := flag.NewFlagSet("env", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the tags as JSON")
+	specPath := flags.String("spec", "", "validate the tags against this ci-app-spec.json file instead of the bundled one")
+	strict := flags.Bool("strict", false, "fail if a required tag of the spec is missing or the detection failed")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: ddtest env [-json] [-spec file] [-strict]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Prints the tags detected in the current directory and where each value came from.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	spec := utils.SpecTags
+	if *specPath != "" {
+		data, err := ioutil.ReadFile(*specPath)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &spec); err != nil {
+			return fmt.Errorf("%s: %v", *specPath, err)
+		}
+	}
+
+	tags, diagnostics := utils.GetCITagsWithDiagnostics()
+	if *specPath != "" {
+		diagnostics.CheckSpec(tags, spec)
+	}
+	report := envReport{
+		Tags:        tags,
+		Diagnostics: diagnostics,
+		NotInSpec:   utils.NotInSpec(tags, spec),
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else if err := report.print(os.Stdout); err != nil {
+		return err
+	}
+
+	if problems := len(diagnostics.Errors) + len(diagnostics.Warnings); *strict && problems > 0 {
+		return fmt.Errorf("%d problem(s) found", problems)
+	}
+	return nil
+}
+
+// print writes the report as a table of the tags followed by the problems found.
+func (r envReport) print(out io.Writer) error {
+	if r.Provider != "" {
+		fmt.Fprintf(out, "CI provider: %s\n\n", r.Provider)
+	} else {
+		fmt.Fprint(out, "CI provider: none detected\n\n")
+	}
+
+	keys := make([]string, 0, len(r.Tags))
+	for key := range r.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	notInSpec := map[string]bool{}
+	for _, key := range r.NotInSpec {
+		notInSpec[key] = true
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tSOURCE\tVALUE")
+	for _, key := range keys {
+		source := r.Sources[key]
+		if source == "" {
+			source = "-"
+		}
+		label := key
+		if notInSpec[key] {
+			label += " *"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", label, source, r.Tags[key])
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(r.NotInSpec) > 0 {
+		fmt.Fprintln(out, "\n* not in the spec")
+	}
+
+	for _, err := range r.Errors {
+		fmt.Fprintf(out, "\nerror: %s", err)
+	}
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(out, "\nwarning: %s", warning)
+	}
+	if len(r.Errors)+len(r.Warnings) > 0 {
+		fmt.Fprintln(out)
+	}
+	return nil
+}
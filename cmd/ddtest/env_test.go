@@ -0,0 +1,95 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/testutil"
+	"github.com/DataDog/dd-sdk-go-testing/internal/utils"
+)
+
+func TestEnvJSON(t *testing.T) {
+	dir, cleanup := testutil.NewRepository(t, 1)
+	defer cleanup()
+	sha := strings.TrimSpace(testutil.Git(t, dir, "rev-parse", "HEAD"))
+
+	out, code := runDDTest(t, dir, "env", "-json", "-strict")
+	if code != 0 {
+		t.Fatalf("expected the exit code 0, got %d:\n%s", code, out)
+	}
+	var report struct {
+		Tags      map[string]string `json:"tags"`
+		Sources   map[string]string `json:"sources"`
+		Warnings  []string          `json:"warnings"`
+		NotInSpec []string          `json:"not_in_spec"`
+	}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	if report.Tags[constants.GitCommitSHA] != sha || report.Sources[constants.GitCommitSHA] != utils.SourceLocalGit {
+		t.Errorf("expected the commit %s from git, got %v", sha, out)
+	}
+	if report.Tags[constants.GitRepositoryURL] != "https://github.com/DataDog/upstream.git" || len(report.Warnings) != 0 {
+		t.Errorf("unexpected report:\n%s", out)
+	}
+	if expected := utils.NotInSpec(report.Tags, utils.SpecTags); !reflect.DeepEqual(report.NotInSpec, expected) {
+		t.Errorf("expected the tags %v not in the spec, got %v", expected, report.NotInSpec)
+	}
+}
+
+func TestEnvStrict(t *testing.T) {
+	dir, cleanup := testutil.NewRepository(t, 1)
+	defer cleanup()
+	// Without a remote, the repository URL can't be detected.
+	testutil.Git(t, dir, "remote", "remove", "upstream")
+
+	out, code := runDDTest(t, dir, "env")
+	if code != 0 || !strings.Contains(out, "warning: missing required tag git.repository_url") {
+		t.Errorf("expected a warning and the exit code 0, got %d:\n%s", code, out)
+	}
+	if out, code := runDDTest(t, dir, "env", "-strict"); code != 1 {
+		t.Errorf("expected the exit code 1, got %d:\n%s", code, out)
+	}
+
+	// A spec without the repository URL doesn't require it.
+	var spec []string
+	for _, tag := range utils.SpecTags {
+		if tag != constants.GitRepositoryURL {
+			spec = append(spec, tag)
+		}
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	specPath := filepath.Join(dir, "ci-app-spec.json")
+	if err := ioutil.WriteFile(specPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, code = runDDTest(t, dir, "env", "-spec", specPath, "-strict")
+	if code != 0 || strings.Contains(out, "warning:") {
+		t.Errorf("expected no warning and the exit code 0, got %d:\n%s", code, out)
+	}
+	if !strings.Contains(out, constants.GitCommitSHA) {
+		t.Errorf("expected the tags to be printed, got:\n%s", out)
+	}
+
+	// The tags detected that the spec doesn't have are marked.
+	if err := ioutil.WriteFile(specPath, []byte(`["git.repository_url"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, code = runDDTest(t, dir, "env", "-spec", specPath, "-strict")
+	if code != 1 || !strings.Contains(out, constants.GitCommitSHA+" *") || !strings.Contains(out, "missing required tag git.repository_url") {
+		t.Errorf("expected the commit not in the spec and the exit code 1, got %d:\n%s", code, out)
+	}
+}
@@ -0,0 +1,98 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/export"
+	"github.com/DataDog/dd-sdk-go-testing/internal/gotest"
+	"github.com/DataDog/dd-sdk-go-testing/internal/utils"
+)
+
+// runGoTest instruments the tests run by `go test -json` with the given arguments, or described
+// by the `go test -json` stream read from stdin when the only argument is "-".
+func runGoTest(args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "-help") {
+		fmt.Fprintln(os.Stderr, "Usage: ddtest gotest [go test arguments]")
+		fmt.Fprintln(os.Stderr, "       go test -json [go test arguments] | ddtest gotest -")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Runs go test -json and sends the executed tests to Datadog, printing their output as go test does.")
+		return nil
+	}
+
+	var (
+		in      io.Reader = os.Stdin
+		cmd     *exec.Cmd
+		command = "go test"
+	)
+	if len(args) != 1 || args[0] != "-" {
+		goArgs := append([]string{"test", "-json"}, args...)
+		command = strings.Join(append([]string{"go"}, goArgs...), " ")
+		cmd = exec.Command("go", goArgs...)
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		in = stdout
+	}
+
+	tags, diagnostics := utils.GetCITagsWithDiagnostics()
+	if utils.DebugEnabled() {
+		diagnostics.Log()
+	}
+	// The directives of the commit message take precedence over the environment, as with ddtesting.Run.
+	directives := utils.ParseDirectives(tags[constants.GitCommitMessage])
+	directives.ApplyTags(tags)
+	cfg := export.ConfigFromEnv()
+	cfg.ApplyDirectives(directives)
+
+	exporter := export.Start(cfg, tags)
+	c := gotest.NewConverter(command, tags)
+	c.SetSessionTag(constants.CIDiagnostics, diagnostics.String())
+	if len(directives.Names) > 0 {
+		c.SetSessionTag(constants.CIDirectives, strings.Join(directives.Names, ","))
+	}
+	err := gotest.Convert(in, os.Stdout, c)
+	c.FinishPackages()
+	if result := exporter.WaitGitUpload(); result.Unshallow != "" {
+		c.SetSessionTag(constants.GitUnshallow, result.Unshallow)
+	}
+	// Deliver the tests before the session, so that it reports the lost payloads.
+	if n := exporter.Drain(); n > 0 {
+		c.SetSessionTag(constants.TestUndeliveredPayloads, n)
+	}
+	c.Finish()
+	exporter.Stop()
+
+	if cmd != nil {
+		// ddtest exits with the exit code of go test, which has already reported the failure.
+		if waitErr := cmd.Wait(); waitErr != nil {
+			if exitErr, ok := waitErr.(*exec.ExitError); ok {
+				if code := exitErr.ExitCode(); code > 0 {
+					return exitError(code)
+				}
+				// Killed by a signal.
+				return exitError(1)
+			}
+			return waitErr
+		}
+	}
+	if err == nil && c.Failed() {
+		return exitError(1)
+	}
+	return err
+}
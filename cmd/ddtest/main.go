@@ -0,0 +1,68 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+// Command ddtest provides tools around the test events produced by the Datadog SDK for Go testing.
+//
+// Usage:
+//
+//	ddtest gotest [go test arguments]
+//	ddtest upload [-batch n] [-remove] [file ...]
+//	ddtest env [-json] [-spec file] [-strict]
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	short string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"gotest", "run go test and send the executed tests to Datadog", runGoTest},
+	{"upload", "send the test events written to an output file to Datadog", runUpload},
+	{"env", "print the CI and git metadata detected, with where it came from", runEnv},
+}
+
+// exitError is the exit code of a command whose failure has already been reported, e.g. by the
+// wrapped go test.
+type exitError int
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: ddtest <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.short)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				if code, ok := err.(exitError); ok {
+					os.Exit(int(code))
+				}
+				fmt.Fprintf(os.Stderr, "ddtest %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(2)
+}
@@ -0,0 +1,74 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/transport"
+)
+
+// runUpload replays the events written by the file exporter to the citestcycle intake,
+// either directly in agentless mode or through the agent EVP proxy.
+func runUpload(args []string) error {
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	batch := flags.Int("batch", 1000, "maximum number of events sent in a single payload")
+	remove := flags.Bool("remove", false, "remove the files once they have been uploaded")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: ddtest upload [-batch n] [-remove] [file ...]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Uploads the files written with DD_CIVISIBILITY_OUTPUT_FILE, which is also the default file.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		if path := os.Getenv("DD_CIVISIBILITY_OUTPUT_FILE"); path != "" {
+			paths = []string{path}
+		}
+	}
+	if len(paths) == 0 {
+		flags.Usage()
+		return errors.New("no file to upload")
+	}
+	if *batch <= 0 {
+		return errors.New("the batch size must be positive")
+	}
+
+	exporter := transport.NewIntakeExporterFromEnv(transport.AgentFromEnv())
+	if exporter == nil {
+		return errors.New("the agent doesn't support the EVP proxy, enable the agentless mode with DD_CIVISIBILITY_AGENTLESS_ENABLED and DD_API_KEY")
+	}
+	defer exporter.Close()
+
+	for _, path := range paths {
+		events, err := transport.ReadEventsFile(path)
+		if err != nil {
+			return err
+		}
+		for start := 0; start < len(events); start += *batch {
+			end := start + *batch
+			if end > len(events) {
+				end = len(events)
+			}
+			if err := exporter.Export(events[start:end]); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d events uploaded\n", path, len(events))
+
+		if *remove {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package dd_sdk_go_testing
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+)
+
+var (
+	// openTests contains the spans of the tests that have been started but not finished yet,
+	// along with their suite name.
+	openTests   = map[ddtrace.Span]string{}
+	openTestsMu sync.Mutex
+
+	// crashHook is installed by Run and shuts down the tracer when the test binary is about to die.
+	crashHook func()
+	crashOnce sync.Once
+)
+
+// cleaner is implemented by testing.T and testing.B since Go 1.14.
+type cleaner interface {
+	Cleanup(func())
+}
+
+func trackTest(tb TB, span ddtrace.Span, suite string) {
+	openTestsMu.Lock()
+	openTests[span] = suite
+	openTestsMu.Unlock()
+
+	// The testing package runs the cleanup functions of a panicking test and all its parents
+	// before re-panicking, that's the last chance we have to send the pending spans.
+	if c, ok := tb.(cleaner); ok {
+		c.Cleanup(func() {
+			if isPanicking() {
+				crash()
+			}
+		})
+	}
+}
+
+func untrackTest(span ddtrace.Span) {
+	openTestsMu.Lock()
+	delete(openTests, span)
+	openTestsMu.Unlock()
+}
+
+// crash finishes every test that is still running as failed and invokes the crash hook.
+func crash() {
+	crashOnce.Do(func() {
+		s := getCurrentSession()
+		openTestsMu.Lock()
+		for span, suite := range openTests {
+			span.SetTag(constants.TestStatus, constants.TestStatusFail)
+			span.SetTag(ext.Error, true)
+			span.SetTag(ext.ErrorMsg, "test binary crashed")
+			span.Finish()
+			if s != nil {
+				s.testFinished(suite, constants.TestStatusFail)
+			}
+		}
+		openTests = map[ddtrace.Span]string{}
+		openTestsMu.Unlock()
+
+		if crashHook != nil {
+			crashHook()
+		}
+	})
+}
+
+// isPanicking reports whether the current goroutine is unwinding from a panic.
+func isPanicking() bool {
+	pcs := make([]uintptr, 64)
+	total := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:total])
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			return true
+		}
+		if !more {
+			return false
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package dd_sdk_go_testing
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/citestcycle"
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/transport"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+)
+
+// crashTestEnv makes TestCrash crash the test binary, which it runs in a subprocess.
+const crashTestEnv = "DD_SDK_GO_TESTING_CRASH_TEST"
+
+func TestCrash(t *testing.T) {
+	if os.Getenv(crashTestEnv) != "" {
+		_, finish := StartTest(t)
+		defer finish()
+
+		t.Run("panic", func(t *testing.T) {
+			_, finish := StartTest(t)
+			defer finish()
+
+			panic("unrecovered panic")
+		})
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "dd-sdk-go-testing-crash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "events.ndjson")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCrash$")
+	cmd.Env = append(os.Environ(), crashTestEnv+"=1", "DD_CIVISIBILITY_OUTPUT_FILE="+output)
+	if out, err := cmd.CombinedOutput(); err == nil {
+		t.Fatalf("expected the test binary to crash:\n%s", out)
+	}
+
+	events, err := transport.ReadEventsFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]citestcycle.Event{}
+	sessions := 0
+	for _, event := range events {
+		switch event.Type {
+		case citestcycle.EventTypeTest:
+			tests[event.Content.Meta[constants.TestName]] = event
+		case citestcycle.EventTypeTestSession:
+			sessions++
+		}
+	}
+	for name, msg := range map[string]string{
+		// Finished by the test itself before re-panicking.
+		"TestCrash/panic": "unrecovered panic",
+		// Still running when the test binary crashed.
+		"TestCrash": "test binary crashed",
+	} {
+		event, ok := tests[name]
+		if !ok {
+			t.Errorf("expected the %s test to be flushed, got %v", name, events)
+			continue
+		}
+		if status := event.Content.Meta[constants.TestStatus]; status != constants.TestStatusFail {
+			t.Errorf("expected the %s test to fail, got %q", name, status)
+		}
+		if event.Content.Meta[ext.ErrorMsg] != msg {
+			t.Errorf("expected the %s test to fail with %q, got %q", name, msg, event.Content.Meta[ext.ErrorMsg])
+		}
+	}
+	if sessions != 1 {
+		t.Errorf("expected the session to be flushed, got %d sessions", sessions)
+	}
+}
@@ -0,0 +1,310 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package ddtestingtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+// Define the types of the recorded events.
+const (
+	// TypeTest is a test execution.
+	TypeTest = constants.SpanTypeTest
+
+	// TypeSuite is a test suite.
+	TypeSuite = constants.SpanTypeTestSuite
+
+	// TypeModule is a test module.
+	TypeModule = constants.SpanTypeTestModule
+
+	// TypeSession is a test session.
+	TypeSession = constants.SpanTypeTestSession
+)
+
+// Define the statuses of the tests, suites, modules and sessions.
+const (
+	// StatusPass marks a passed test.
+	StatusPass = constants.TestStatusPass
+
+	// StatusFail marks a failed test.
+	StatusFail = constants.TestStatusFail
+
+	// StatusSkip marks a skipped test.
+	StatusSkip = constants.TestStatusSkip
+)
+
+// Event is a span recorded by a Recorder, either a test, a suite, a module, a session, or any other
+// span created while running a test.
+type Event struct {
+	span mocktracer.Span
+}
+
+// Span returns the underlying span.
+func (e Event) Span() mocktracer.Span { return e.span }
+
+// String returns a description of the event including all its tags.
+func (e Event) String() string { return fmt.Sprint(e.span) }
+
+// Type returns the type of the event, e.g. TypeTest.
+func (e Event) Type() string { return e.Tag(ext.SpanType) }
+
+// Tag returns the value of the given tag formatted as a string, or an empty string if it's not set.
+func (e Event) Tag(key string) string {
+	switch v := e.span.Tag(key).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// HasTag reports whether the given tag is set.
+func (e Event) HasTag(key string) bool { return e.span.Tag(key) != nil }
+
+func (e Event) id(key string) uint64 {
+	id, _ := strconv.ParseUint(e.Tag(key), 10, 64)
+	return id
+}
+
+func (e Event) number(key string) int {
+	n, _ := strconv.Atoi(e.Tag(key))
+	return n
+}
+
+// Resource returns the resource name of the event.
+func (e Event) Resource() string { return e.Tag(ext.ResourceName) }
+
+// Service returns the service name of the event.
+func (e Event) Service() string { return e.Tag(ext.ServiceName) }
+
+// Error reports whether the event is flagged as an error.
+func (e Event) Error() bool {
+	switch v := e.span.Tag(ext.Error).(type) {
+	case bool:
+		return v
+	case error:
+		return v != nil
+	default:
+		return false
+	}
+}
+
+// ErrorMessage returns the error.msg tag.
+func (e Event) ErrorMessage() string { return e.Tag(ext.ErrorMsg) }
+
+// ErrorType returns the error.type tag.
+func (e Event) ErrorType() string { return e.Tag(ext.ErrorType) }
+
+// ErrorStack returns the error.stack tag.
+func (e Event) ErrorStack() string { return e.Tag(ext.ErrorStack) }
+
+// SpanKind returns the span.kind tag.
+func (e Event) SpanKind() string { return e.Tag(constants.SpanKind) }
+
+// Origin returns the _dd.origin tag.
+func (e Event) Origin() string { return e.Tag(constants.Origin) }
+
+// TestName returns the test.name tag.
+func (e Event) TestName() string { return e.Tag(constants.TestName) }
+
+// TestSuite returns the test.suite tag.
+func (e Event) TestSuite() string { return e.Tag(constants.TestSuite) }
+
+// TestFramework returns the test.framework tag.
+func (e Event) TestFramework() string { return e.Tag(constants.TestFramework) }
+
+// TestStatus returns the test.status tag, e.g. StatusPass.
+func (e Event) TestStatus() string { return e.Tag(constants.TestStatus) }
+
+// TestType returns the test.type tag.
+func (e Event) TestType() string { return e.Tag(constants.TestType) }
+
+// TestSkipReason returns the test.skip_reason tag.
+func (e Event) TestSkipReason() string { return e.Tag(constants.TestSkipReason) }
+
+// TestSourceFile returns the test.source.file tag.
+func (e Event) TestSourceFile() string { return e.Tag(constants.TestSourceFile) }
+
+// TestSourceStartLine returns the test.source.start tag, 0 if not set.
+func (e Event) TestSourceStartLine() int { return e.number(constants.TestSourceStartLine) }
+
+// TestSourceEndLine returns the test.source.end tag, 0 if not set.
+func (e Event) TestSourceEndLine() int { return e.number(constants.TestSourceEndLine) }
+
+// TestIsModified reports whether the test.is_modified tag is set to true.
+func (e Event) TestIsModified() bool { return e.Tag(constants.TestIsModified) == "true" }
+
+// TestModule returns the test.module tag.
+func (e Event) TestModule() string { return e.Tag(constants.TestModule) }
+
+// TestCommand returns the test.command tag.
+func (e Event) TestCommand() string { return e.Tag(constants.TestCommand) }
+
+// TestSessionID returns the ID of the session of the event, or its own ID for a session.
+func (e Event) TestSessionID() uint64 {
+	if e.Type() == TypeSession {
+		return e.span.SpanID()
+	}
+	return e.id(constants.TestSessionID)
+}
+
+// TestModuleID returns the ID of the module of the event, or its own ID for a module.
+func (e Event) TestModuleID() uint64 {
+	if e.Type() == TypeModule {
+		return e.span.SpanID()
+	}
+	return e.id(constants.TestModuleID)
+}
+
+// TestSuiteID returns the ID of the suite of the event, or its own ID for a suite.
+func (e Event) TestSuiteID() uint64 {
+	if e.Type() == TypeSuite {
+		return e.span.SpanID()
+	}
+	return e.id(constants.TestSuiteID)
+}
+
+// TestUndeliveredPayloads returns the test.undelivered_payloads tag of a session, 0 if not set.
+func (e Event) TestUndeliveredPayloads() int { return e.number(constants.TestUndeliveredPayloads) }
+
+// CIJobName returns the ci.job.name tag.
+func (e Event) CIJobName() string { return e.Tag(constants.CIJobName) }
+
+// CIJobURL returns the ci.job.url tag.
+func (e Event) CIJobURL() string { return e.Tag(constants.CIJobURL) }
+
+// CIPipelineID returns the ci.pipeline.id tag.
+func (e Event) CIPipelineID() string { return e.Tag(constants.CIPipelineID) }
+
+// CIPipelineName returns the ci.pipeline.name tag.
+func (e Event) CIPipelineName() string { return e.Tag(constants.CIPipelineName) }
+
+// CIPipelineNumber returns the ci.pipeline.number tag.
+func (e Event) CIPipelineNumber() string { return e.Tag(constants.CIPipelineNumber) }
+
+// CIPipelineURL returns the ci.pipeline.url tag.
+func (e Event) CIPipelineURL() string { return e.Tag(constants.CIPipelineURL) }
+
+// CIProviderName returns the ci.provider.name tag.
+func (e Event) CIProviderName() string { return e.Tag(constants.CIProviderName) }
+
+// CINodeName returns the ci.node.name tag.
+func (e Event) CINodeName() string { return e.Tag(constants.CINodeName) }
+
+// CINodeLabels returns the labels of the ci.node.labels tag, nil if not set.
+func (e Event) CINodeLabels() []string {
+	var labels []string
+	json.Unmarshal([]byte(e.Tag(constants.CINodeLabels)), &labels)
+	return labels
+}
+
+// CIStageName returns the ci.stage.name tag.
+func (e Event) CIStageName() string { return e.Tag(constants.CIStageName) }
+
+// CIWorkspacePath returns the ci.workspace_path tag.
+func (e Event) CIWorkspacePath() string { return e.Tag(constants.CIWorkspacePath) }
+
+// CIEnvVars returns the environment variables recorded in the _dd.ci.env_vars tag.
+func (e Event) CIEnvVars() map[string]string {
+	vars := map[string]string{}
+	json.Unmarshal([]byte(e.Tag(constants.CIEnvVars)), &vars)
+	return vars
+}
+
+// GitBranch returns the git.branch tag.
+func (e Event) GitBranch() string { return e.Tag(constants.GitBranch) }
+
+// GitTag returns the git.tag tag.
+func (e Event) GitTag() string { return e.Tag(constants.GitTag) }
+
+// GitCommitHeadSHA returns the git.commit.head_sha tag.
+func (e Event) GitCommitHeadSHA() string { return e.Tag(constants.GitCommitHeadSHA) }
+
+// GitPullRequestBaseBranch returns the git.pull_request.base_branch tag.
+func (e Event) GitPullRequestBaseBranch() string { return e.Tag(constants.GitPullRequestBaseBranch) }
+
+// GitPullRequestBaseBranchSHA returns the git.pull_request.base_branch_sha tag.
+func (e Event) GitPullRequestBaseBranchSHA() string { return e.Tag(constants.GitPullRequestBaseBranchSHA) }
+
+// PullRequestNumber returns the pr.number tag.
+func (e Event) PullRequestNumber() string { return e.Tag(constants.PullRequestNumber) }
+
+// GitRepositoryURL returns the git.repository_url tag.
+func (e Event) GitRepositoryURL() string { return e.Tag(constants.GitRepositoryURL) }
+
+// GitCommitSHA returns the git.commit.sha tag.
+func (e Event) GitCommitSHA() string { return e.Tag(constants.GitCommitSHA) }
+
+// GitCommitMessage returns the git.commit.message tag.
+func (e Event) GitCommitMessage() string { return e.Tag(constants.GitCommitMessage) }
+
+// GitCommitAuthorDate returns the git.commit.author.date tag.
+func (e Event) GitCommitAuthorDate() string { return e.Tag(constants.GitCommitAuthorDate) }
+
+// GitCommitAuthorEmail returns the git.commit.author.email tag.
+func (e Event) GitCommitAuthorEmail() string { return e.Tag(constants.GitCommitAuthorEmail) }
+
+// GitCommitAuthorName returns the git.commit.author.name tag.
+func (e Event) GitCommitAuthorName() string { return e.Tag(constants.GitCommitAuthorName) }
+
+// GitCommitCommitterDate returns the git.commit.committer.date tag.
+func (e Event) GitCommitCommitterDate() string { return e.Tag(constants.GitCommitCommitterDate) }
+
+// GitCommitCommitterEmail returns the git.commit.committer.email tag.
+func (e Event) GitCommitCommitterEmail() string { return e.Tag(constants.GitCommitCommitterEmail) }
+
+// GitCommitCommitterName returns the git.commit.committer.name tag.
+func (e Event) GitCommitCommitterName() string { return e.Tag(constants.GitCommitCommitterName) }
+
+// GitDirty reports whether the git.dirty tag is "true", i.e. the tests ran on uncommitted changes.
+func (e Event) GitDirty() bool { return e.Tag(constants.GitDirty) == "true" }
+
+// GitDirtyModifiedFiles returns the git.dirty.modified_files tag, 0 if not set.
+func (e Event) GitDirtyModifiedFiles() int { return e.number(constants.GitDirtyModifiedFiles) }
+
+// GitDirtyUntrackedFiles returns the git.dirty.untracked_files tag, 0 if not set.
+func (e Event) GitDirtyUntrackedFiles() int { return e.number(constants.GitDirtyUntrackedFiles) }
+
+// GitDirtyDiffSHA returns the git.dirty.diff_sha tag.
+func (e Event) GitDirtyDiffSHA() string { return e.Tag(constants.GitDirtyDiffSHA) }
+
+// GitSubmoduleRepositoryURL returns the git.submodule.repository_url tag.
+func (e Event) GitSubmoduleRepositoryURL() string { return e.Tag(constants.GitSubmoduleRepositoryURL) }
+
+// GitSubmoduleCommitSHA returns the git.submodule.commit.sha tag.
+func (e Event) GitSubmoduleCommitSHA() string { return e.Tag(constants.GitSubmoduleCommitSHA) }
+
+// GitUnshallow returns the _dd.git.unshallow tag of a session, e.g. "success".
+func (e Event) GitUnshallow() string { return e.Tag(constants.GitUnshallow) }
+
+// CIDiagnostics returns the _dd.ci.diagnostics tag of a session, encoded as JSON.
+func (e Event) CIDiagnostics() string { return e.Tag(constants.CIDiagnostics) }
+
+// CIDirectives returns the _dd.ci.directives tag of a session, e.g. "skip-git-upload,tags".
+func (e Event) CIDirectives() string { return e.Tag(constants.CIDirectives) }
+
+// OSPlatform returns the os.platform tag.
+func (e Event) OSPlatform() string { return e.Tag(constants.OSPlatform) }
+
+// OSVersion returns the os.version tag.
+func (e Event) OSVersion() string { return e.Tag(constants.OSVersion) }
+
+// OSArchitecture returns the os.architecture tag.
+func (e Event) OSArchitecture() string { return e.Tag(constants.OSArchitecture) }
+
+// RuntimeName returns the runtime.name tag.
+func (e Event) RuntimeName() string { return e.Tag(constants.RuntimeName) }
+
+// RuntimeVersion returns the runtime.version tag.
+func (e Event) RuntimeVersion() string { return e.Tag(constants.RuntimeVersion) }
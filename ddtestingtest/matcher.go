@@ -0,0 +1,104 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package ddtestingtest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+)
+
+// Matcher checks a property of a recorded event.
+type Matcher interface {
+	// Match reports whether the event has the property.
+	Match(e Event) bool
+	// String describes the property, it is used in the failure messages.
+	String() string
+}
+
+type matcher struct {
+	desc  string
+	match func(Event) bool
+}
+
+func (m matcher) Match(e Event) bool { return m.match(e) }
+func (m matcher) String() string     { return m.desc }
+
+// MatcherFunc returns a Matcher described by desc and checking events with fn.
+func MatcherFunc(desc string, fn func(Event) bool) Matcher {
+	return matcher{desc: desc, match: fn}
+}
+
+// OfType matches the events of the given type, e.g. TypeSuite.
+func OfType(eventType string) Matcher {
+	return MatcherFunc(fmt.Sprintf("is a %s", eventType), func(e Event) bool {
+		return e.Type() == eventType
+	})
+}
+
+// Named matches the tests with the given name, e.g. "TestFoo/sub".
+func Named(name string) Matcher {
+	return HasTag(constants.TestName, name)
+}
+
+// InSuite matches the events of the given suite.
+func InSuite(suite string) Matcher {
+	return HasTag(constants.TestSuite, suite)
+}
+
+// HasStatus matches the events with the given status, e.g. StatusPass.
+func HasStatus(status string) Matcher {
+	return HasTag(constants.TestStatus, status)
+}
+
+// Passed matches the passed tests, suites, modules and sessions.
+func Passed() Matcher { return HasStatus(StatusPass) }
+
+// Failed matches the failed tests, suites, modules and sessions.
+func Failed() Matcher { return HasStatus(StatusFail) }
+
+// Skipped matches the skipped tests, suites, modules and sessions.
+func Skipped() Matcher { return HasStatus(StatusSkip) }
+
+// HasTag matches the events with the given tag set to value. Values are compared by their string
+// representation, so that HasTag("retries", 2) matches a tag set to "2".
+func HasTag(key string, value interface{}) Matcher {
+	expected := fmt.Sprint(value)
+	return MatcherFunc(fmt.Sprintf("%s=%q", key, expected), func(e Event) bool {
+		return e.HasTag(key) && e.Tag(key) == expected
+	})
+}
+
+// HasTagKey matches the events with the given tag set, whatever its value.
+func HasTagKey(key string) Matcher {
+	return MatcherFunc(fmt.Sprintf("has %s", key), func(e Event) bool {
+		return e.HasTag(key)
+	})
+}
+
+// Not matches the events not matched by m.
+func Not(m Matcher) Matcher {
+	return MatcherFunc(fmt.Sprintf("not %s", m), func(e Event) bool {
+		return !m.Match(e)
+	})
+}
+
+// AllOf matches the events matched by all the matchers.
+func AllOf(matchers ...Matcher) Matcher {
+	descs := make([]string, len(matchers))
+	for i, m := range matchers {
+		descs[i] = m.String()
+	}
+	return MatcherFunc(strings.Join(descs, " and "), func(e Event) bool {
+		for _, m := range matchers {
+			if !m.Match(e) {
+				return false
+			}
+		}
+		return true
+	})
+}
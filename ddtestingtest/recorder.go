@@ -0,0 +1,159 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+// Package ddtestingtest provides utilities to test code wrapping the Datadog SDK for Go testing,
+// e.g. helpers calling ddtesting.StartTestWithContext. A Recorder keeps in memory the test, suite,
+// module and session events which can then be checked with matchers:
+//
+//	func TestMyWrapper(t *testing.T) {
+//		r := ddtestingtest.Start()
+//		defer r.Stop()
+//
+//		t.Run("sub", func(t *testing.T) {
+//			finish := myWrapper(t)
+//			defer finish()
+//		})
+//
+//		r.ExpectTest(t, "TestMyWrapper/sub", ddtestingtest.Passed(), ddtestingtest.HasTag("team", "core"))
+//	}
+package ddtestingtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	// The instrumentation registers the test hooks used by the recorder.
+	_ "github.com/DataDog/dd-sdk-go-testing"
+	"github.com/DataDog/dd-sdk-go-testing/internal/testhook"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+// TB is the subset of testing.TB used to report unmet expectations.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Recorder records in memory the spans created by the instrumentation. While a Recorder is started,
+// it replaces the global tracer and the tests are linked to a new test session, so it must not be
+// used concurrently with other instrumented tests, e.g. in parallel tests.
+type Recorder struct {
+	mt            mocktracer.Tracer
+	finishSession func()
+	once          sync.Once
+}
+
+// Start starts recording the spans of the instrumented tests.
+func Start() *Recorder {
+	r := &Recorder{mt: mocktracer.Start()}
+	r.finishSession = testhook.StartSession()
+	return r
+}
+
+// FinishSession finishes the suites, the module and the session of the recorded tests, so that
+// their events are recorded. Tests started afterwards aren't linked to any session.
+func (r *Recorder) FinishSession() {
+	r.once.Do(r.finishSession)
+}
+
+// Stop finishes the session and stops the recorder. The tracer started by ddtesting.Run, which the
+// recorder stopped, is started again with the same options. The recorded events remain available.
+func (r *Recorder) Stop() {
+	r.FinishSession()
+	r.mt.Stop()
+	testhook.RestoreTracer()
+}
+
+// Reset discards the events recorded so far.
+func (r *Recorder) Reset() {
+	r.mt.Reset()
+}
+
+// Events returns all the finished spans, in the order they finished.
+func (r *Recorder) Events() []Event {
+	spans := r.mt.FinishedSpans()
+	events := make([]Event, len(spans))
+	for i, span := range spans {
+		events[i] = Event{span: span}
+	}
+	return events
+}
+
+// Find returns the events matched by all the matchers.
+func (r *Recorder) Find(matchers ...Matcher) []Event {
+	m := AllOf(matchers...)
+	var events []Event
+	for _, e := range r.Events() {
+		if m.Match(e) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Tests returns the finished tests.
+func (r *Recorder) Tests() []Event { return r.Find(OfType(TypeTest)) }
+
+// Suites returns the finished suites.
+func (r *Recorder) Suites() []Event { return r.Find(OfType(TypeSuite)) }
+
+// Modules returns the finished modules.
+func (r *Recorder) Modules() []Event { return r.Find(OfType(TypeModule)) }
+
+// Sessions returns the finished sessions.
+func (r *Recorder) Sessions() []Event { return r.Find(OfType(TypeSession)) }
+
+// Test returns the first finished test with the given name.
+func (r *Recorder) Test(name string) (Event, bool) {
+	tests := r.Find(OfType(TypeTest), Named(name))
+	if len(tests) == 0 {
+		return Event{}, false
+	}
+	return tests[0], true
+}
+
+// Expect reports an error on tb unless an event is matched by all the matchers.
+func (r *Recorder) Expect(tb TB, matchers ...Matcher) bool {
+	tb.Helper()
+	if len(r.Find(matchers...)) > 0 {
+		return true
+	}
+	tb.Errorf("ddtestingtest: no event %s, recorded:\n%s", AllOf(matchers...), describe(r.Events()))
+	return false
+}
+
+// ExpectTest reports an error on tb unless a test with the given name finished and is matched by
+// all the matchers.
+func (r *Recorder) ExpectTest(tb TB, name string, matchers ...Matcher) bool {
+	tb.Helper()
+	test, ok := r.Test(name)
+	if !ok {
+		tb.Errorf("ddtestingtest: no test named %q, recorded:\n%s", name, describe(r.Tests()))
+		return false
+	}
+	var unmet []string
+	for _, m := range matchers {
+		if !m.Match(test) {
+			unmet = append(unmet, m.String())
+		}
+	}
+	if len(unmet) > 0 {
+		tb.Errorf("ddtestingtest: test %q doesn't match %s:\n%s", name, strings.Join(unmet, ", "), test)
+		return false
+	}
+	return true
+}
+
+func describe(events []Event) string {
+	if len(events) == 0 {
+		return "  nothing"
+	}
+	lines := make([]string, len(events))
+	for i, e := range events {
+		lines[i] = fmt.Sprintf("  %s %s (%s)", e.Type(), e.Resource(), e.TestStatus())
+	}
+	return strings.Join(lines, "\n")
+}
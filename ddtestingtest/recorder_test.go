@@ -0,0 +1,107 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package ddtestingtest_test
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	ddtesting "github.com/DataDog/dd-sdk-go-testing"
+	"github.com/DataDog/dd-sdk-go-testing/ddtestingtest"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// startTeamTest is the kind of wrapper the recorder is meant to test.
+func startTeamTest(t *testing.T) ddtesting.FinishFunc {
+	_, finish := ddtesting.StartTest(t, ddtesting.WithIncrementSkipFrame(),
+		ddtesting.WithSpanOptions(tracer.Tag("team", "core"), tracer.Tag("retries", 2)))
+	return finish
+}
+
+type fakeTB struct {
+	errors []string
+}
+
+func (tb *fakeTB) Helper() {}
+
+func (tb *fakeTB) Errorf(format string, args ...interface{}) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRecorder(t *testing.T) {
+	_, _, line, _ := runtime.Caller(0)
+	r := ddtestingtest.Start()
+	defer r.Stop()
+
+	t.Run("pass", func(t *testing.T) {
+		finish := startTeamTest(t)
+		defer finish()
+	})
+	t.Run("skip", func(t *testing.T) {
+		finish := startTeamTest(t)
+		defer finish()
+		t.Skip("not today")
+	})
+	r.FinishSession()
+
+	const suite = "github.com/DataDog/dd-sdk-go-testing/ddtestingtest_test"
+	r.ExpectTest(t, "TestRecorder/pass", ddtestingtest.Passed(), ddtestingtest.InSuite(suite),
+		ddtestingtest.HasTag("team", "core"), ddtestingtest.HasTag("retries", 2))
+	r.ExpectTest(t, "TestRecorder/skip", ddtestingtest.Skipped(), ddtestingtest.Not(ddtestingtest.Passed()))
+	r.Expect(t, ddtestingtest.OfType(ddtestingtest.TypeSuite), ddtestingtest.InSuite(suite), ddtestingtest.Passed())
+
+	if tests := r.Tests(); len(tests) != 2 {
+		t.Fatalf("expected 2 tests, got %d", len(tests))
+	}
+	sessions, modules, suites := r.Sessions(), r.Modules(), r.Suites()
+	if len(sessions) != 1 || len(modules) != 1 || len(suites) != 1 {
+		t.Fatalf("expected a single session, module and suite, got %d, %d and %d", len(sessions), len(modules), len(suites))
+	}
+	test, _ := r.Test("TestRecorder/pass")
+	if test.TestSessionID() != sessions[0].TestSessionID() || test.TestModuleID() != modules[0].TestModuleID() ||
+		test.TestSuiteID() != suites[0].TestSuiteID() {
+		t.Error("the test is not linked to the recorded session, module and suite")
+	}
+	if test.TestModule() != suite || test.TestFramework() != "golang.org/pkg/testing" || test.Error() {
+		t.Errorf("unexpected test tags: %s", test)
+	}
+	if test.OSPlatform() == "" || test.RuntimeVersion() == "" {
+		t.Errorf("missing CI tags: %s", test)
+	}
+	if !strings.HasSuffix(test.TestSourceFile(), "ddtestingtest/recorder_test.go") || test.TestSourceStartLine() != line-1 ||
+		test.TestSourceEndLine() <= line {
+		t.Errorf("unexpected source of the test: %s", test)
+	}
+}
+
+func TestRecorderReportsUnmetExpectations(t *testing.T) {
+	r := ddtestingtest.Start()
+	defer r.Stop()
+
+	t.Run("pass", func(t *testing.T) {
+		finish := startTeamTest(t)
+		defer finish()
+	})
+
+	tb := &fakeTB{}
+	if r.ExpectTest(tb, "TestRecorderReportsUnmetExpectations/pass", ddtestingtest.Failed(), ddtestingtest.HasTag("team", "core")) {
+		t.Error("the expectation should not be met")
+	}
+	if r.ExpectTest(tb, "TestMissing") {
+		t.Error("the missing test should not be found")
+	}
+	if len(tb.errors) != 2 {
+		t.Fatalf("expected 2 errors, got %v", tb.errors)
+	}
+	if !strings.Contains(tb.errors[0], `doesn't match test.status="fail":`) {
+		t.Errorf("unexpected error: %s", tb.errors[0])
+	}
+	if !strings.Contains(tb.errors[1], `no test named "TestMissing"`) || !strings.Contains(tb.errors[1], "TestRecorderReportsUnmetExpectations/pass (pass)") {
+		t.Errorf("unexpected error: %s", tb.errors[1])
+	}
+}
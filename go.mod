@@ -7,6 +7,7 @@ require (
 	github.com/google/uuid v1.2.0 // indirect
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/philhofer/fwd v1.1.1 // indirect
+	github.com/tinylib/msgp v1.1.2
 	golang.org/x/sys v0.0.0-20210124154548-22da62e12c0c
 	golang.org/x/time v0.0.0-20210611083556-38a9dc6acbc6 // indirect
 	gopkg.in/DataDog/dd-trace-go.v1 v1.31.1
@@ -11,58 +11,71 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"regexp"
 	"runtime"
-	"strings"
+	"sync"
 	"syscall"
 	"testing"
 
 	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/export"
+	"github.com/DataDog/dd-sdk-go-testing/internal/testspan"
 	"github.com/DataDog/dd-sdk-go-testing/internal/utils"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
-const (
-	spanKind      = "test"
-	testFramework = "golang.org/pkg/testing"
-)
-
-var repoRegex = regexp.MustCompile(`(?m)\/([a-zA-Z0-9\\\-_.]*)$`)
-
 // FinishFunc closes a started span and attaches test status information.
 type FinishFunc func()
 
-// Run is a helper function to run a `testing.M` object and gracefully stopping the tracer afterwards
+// Run is a helper function to run a `testing.M` object and gracefully stopping the tracer afterwards.
+// The tracer is also stopped if the test binary receives SIGINT or SIGTERM, or if it is about
+// to crash because of a panicking test.
 func Run(m *testing.M, opts ...tracer.StartOption) int {
-	// Preload all CI and Git tags.
-	ensureCITags()
+	return RunWithOptions(m, WithTracerOptions(opts...))
+}
 
-	// Check if DD_SERVICE has been set; otherwise we default to repo name.
-	if v := os.Getenv("DD_SERVICE"); v == "" {
-		if repoUrl, ok := getFromCITags(constants.GitRepositoryURL); ok {
-			matches := repoRegex.FindStringSubmatch(repoUrl)
-			if len(matches) > 1 {
-				repoUrl = strings.TrimSuffix(matches[1], ".git")
-			}
-			opts = append(opts, tracer.WithService(repoUrl))
-		}
+// RunWithOptions is like Run but accepts RunOptions to configure how the test events are exported.
+func RunWithOptions(m *testing.M, runOpts ...RunOption) int {
+	cfg := new(runConfig)
+	runDefaults(cfg)
+	for _, fn := range runOpts {
+		fn(cfg)
 	}
 
-	// Initialize tracer
-	tracer.Start(opts...)
+	// Preload all CI and Git tags.
+	ensureCITags()
+	cfg.ApplyDirectives(directives)
+	getGitDiff()
+
+	// Initialize tracer, and upload the git metadata while the tests run.
+	exporter := export.Start(cfg.Config, tags, cfg.tracerOpts...)
+	s := startSession()
+	currentMu.Lock()
+	currentSession, currentExporter = s, exporter
+	currentMu.Unlock()
+	var exitOnce sync.Once
 	exitFunc := func() {
-		tracer.Flush()
-		tracer.Stop()
+		exitOnce.Do(func() {
+			s.finishModule()
+			s.setGitUpload(exporter.WaitGitUpload())
+			// Deliver the tests before the session, so that it reports the lost payloads.
+			s.setUndelivered(exporter.Drain())
+			s.finish()
+			currentMu.Lock()
+			currentExporter = nil
+			currentMu.Unlock()
+			exporter.Stop()
+		})
 	}
 	defer exitFunc()
+	crashHook = exitFunc
 
 	// Handle SIGINT and SIGTERM
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-signals
-		exitFunc()
+		crash()
 		os.Exit(1)
 	}()
 
@@ -105,10 +118,12 @@ func StartTestWithContext(ctx context.Context, tb TB, opts ...Option) (context.C
 		tracer.ResourceName(fqn),
 		tracer.Tag(constants.TestName, name),
 		tracer.Tag(constants.TestSuite, suite),
-		tracer.Tag(constants.TestFramework, testFramework),
+		tracer.Tag(constants.TestFramework, testspan.Framework),
 		tracer.Tag(constants.Origin, constants.CIAppTestOrigin),
 	}
 
+	testOpts = append(testOpts, sourceOptions(pc)...)
+
 	switch tb.(type) {
 	case *testing.T:
 		testOpts = append(testOpts, tracer.Tag(constants.TestType, constants.TestTypeTest))
@@ -116,11 +131,18 @@ func StartTestWithContext(ctx context.Context, tb TB, opts ...Option) (context.C
 		testOpts = append(testOpts, tracer.Tag(constants.TestType, constants.TestTypeBenchmark))
 	}
 
+	s := getCurrentSession()
+	if s != nil {
+		testOpts = append(testOpts, s.testOptions(suite)...)
+	}
+
 	cfg.spanOpts = append(testOpts, cfg.spanOpts...)
 	span, ctx := tracer.StartSpanFromContext(ctx, constants.SpanTypeTest, cfg.spanOpts...)
+	trackTest(tb, span, suite)
 
 	return ctx, func() {
 		var r interface{} = nil
+		status := constants.TestStatusFail
 
 		if r = recover(); r != nil {
 			// Panic handling
@@ -134,19 +156,25 @@ func StartTestWithContext(ctx context.Context, tb TB, opts ...Option) (context.C
 			span.SetTag(ext.Error, tb.Failed())
 
 			if tb.Failed() {
-				span.SetTag(constants.TestStatus, constants.TestStatusFail)
+				status = constants.TestStatusFail
 			} else if tb.Skipped() {
-				span.SetTag(constants.TestStatus, constants.TestStatusSkip)
+				status = constants.TestStatusSkip
 			} else {
-				span.SetTag(constants.TestStatus, constants.TestStatusPass)
+				status = constants.TestStatusPass
 			}
+			span.SetTag(constants.TestStatus, status)
 		}
 
 		span.Finish(cfg.finishOpts...)
+		untrackTest(span)
+		if s != nil {
+			s.testFinished(suite, status)
+		}
 
 		if r != nil {
+			// The panic may still be recovered by the caller, so the tracer is kept running
+			// for the remaining tests. If it isn't, the crash hook takes care of the shutdown.
 			tracer.Flush()
-			tracer.Stop()
 			panic(r)
 		}
 	}
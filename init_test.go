@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/testhook"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -20,6 +21,21 @@ func TestMain(m *testing.M) {
 	os.Exit(Run(m))
 }
 
+func TestRestoreTracer(t *testing.T) {
+	mt := mocktracer.Start()
+	mt.Stop()
+	if span := tracer.StartSpan("test"); span.Context().SpanID() != 0 {
+		t.Fatal("expected the no-op tracer once the mock tracer stopped")
+	}
+
+	testhook.RestoreTracer()
+	span := tracer.StartSpan("test")
+	defer span.Finish()
+	if span.Context().SpanID() == 0 {
+		t.Error("the tracer started by Run was not restored")
+	}
+}
+
 func TestStatus(t *testing.T) {
 	mt := mocktracer.Start()
 	defer mt.Stop()
@@ -100,6 +116,37 @@ func TestPanic(t *testing.T) {
 	assertNotEmpty(s.Tag(ext.ErrorStack).(string))
 }
 
+func TestPanicKeepsTracerRunning(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	t.Run("panic", func(t *testing.T) {
+		defer func() {
+			// recover panic to finish the subtest successfully
+			recover()
+		}()
+
+		_, finish := StartTest(t)
+		defer finish()
+
+		panic("forced panic")
+	})
+
+	t.Run("after-panic", func(t *testing.T) {
+		_, finish := StartTest(t)
+		defer finish()
+	})
+
+	spans := mt.FinishedSpans()
+	if len(spans) != 2 {
+		t.FailNow()
+	}
+
+	assertEqual(constants.TestStatusFail, spans[0].Tag(constants.TestStatus).(string))
+	assertEqual("TestPanicKeepsTracerRunning/after-panic", spans[1].Tag(constants.TestName).(string))
+	assertEqual(constants.TestStatusPass, spans[1].Tag(constants.TestStatus).(string))
+}
+
 func commonEqualCheck(s mocktracer.Span) {
 	assertEqual(constants.SpanTypeTest, s.Tag(ext.SpanType).(string))
 	assertEqual(constants.SpanTypeTest, s.Tag(constants.SpanKind).(string))
@@ -121,6 +168,10 @@ func commonNotEmptyCheck(s mocktracer.Span) {
 	assertNotEmpty(s.Tag(constants.OSArchitecture).(string))
 	assertNotEmpty(s.Tag(constants.OSPlatform).(string))
 	assertNotEmpty(s.Tag(constants.OSVersion).(string))
+	assertNotEmpty(s.Tag(constants.TestModule).(string))
+	assertNotEmpty(s.Tag(constants.TestSessionID).(string))
+	assertNotEmpty(s.Tag(constants.TestModuleID).(string))
+	assertNotEmpty(s.Tag(constants.TestSuiteID).(string))
 }
 
 func assertEqual(expected string, actual string) {
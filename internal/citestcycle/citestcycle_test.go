@@ -0,0 +1,137 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package citestcycle
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// appendSpan encodes a span the same way the tracer does.
+func appendSpan(b []byte, span Span) []byte {
+	b = msgp.AppendMapHeader(b, 12)
+	b = msgp.AppendString(b, "name")
+	b = msgp.AppendString(b, span.Name)
+	b = msgp.AppendString(b, "service")
+	b = msgp.AppendString(b, span.Service)
+	b = msgp.AppendString(b, "resource")
+	b = msgp.AppendString(b, span.Resource)
+	b = msgp.AppendString(b, "type")
+	b = msgp.AppendString(b, span.Type)
+	b = msgp.AppendString(b, "start")
+	b = msgp.AppendInt64(b, span.Start)
+	b = msgp.AppendString(b, "duration")
+	b = msgp.AppendInt64(b, span.Duration)
+	b = msgp.AppendString(b, "meta")
+	b = msgp.AppendMapStrStr(b, span.Meta)
+	b = msgp.AppendString(b, "metrics")
+	b = msgp.AppendMapHeader(b, uint32(len(span.Metrics)))
+	for k, v := range span.Metrics {
+		b = msgp.AppendString(b, k)
+		b = msgp.AppendFloat64(b, v)
+	}
+	b = msgp.AppendString(b, "span_id")
+	b = msgp.AppendUint64(b, span.SpanID)
+	b = msgp.AppendString(b, "trace_id")
+	b = msgp.AppendUint64(b, span.TraceID)
+	b = msgp.AppendString(b, "parent_id")
+	b = msgp.AppendUint64(b, span.ParentID)
+	b = msgp.AppendString(b, "error")
+	b = msgp.AppendInt32(b, span.Error)
+	return b
+}
+
+func TestDecodeTraces(t *testing.T) {
+	test := Span{
+		Name:     "test",
+		Service:  "my-service",
+		Resource: "pkg.TestA",
+		Type:     "test",
+		Start:    1000,
+		Duration: 20,
+		Meta:     map[string]string{"test.status": "pass", "test_suite_id": "18446744073709551615"},
+		Metrics:  map[string]float64{"_sampling_priority_v1": 2},
+		SpanID:   2,
+		TraceID:  2,
+	}
+	child := Span{
+		Name:     "http.request",
+		Type:     "http",
+		SpanID:   3,
+		TraceID:  2,
+		ParentID: 2,
+		Error:    1,
+	}
+
+	b := msgp.AppendArrayHeader(nil, 1)
+	b = msgp.AppendArrayHeader(b, 2)
+	b = appendSpan(b, test)
+	b = appendSpan(b, child)
+
+	spans, err := DecodeTraces(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Resource != "pkg.TestA" || spans[0].Meta["test.status"] != "pass" || spans[0].Metrics["_sampling_priority_v1"] != 2 {
+		t.Fatalf("unexpected span: %+v", spans[0])
+	}
+	if spans[1].ParentID != 2 || spans[1].Error != 1 {
+		t.Fatalf("unexpected span: %+v", spans[1])
+	}
+
+	events := NewEvents(spans)
+	if events[0].Type != EventTypeTest || events[0].Version != 2 {
+		t.Fatalf("unexpected event: %+v", events[0])
+	}
+	if events[0].Content.TestSuiteID != 18446744073709551615 {
+		t.Fatalf("unexpected suite id: %d", events[0].Content.TestSuiteID)
+	}
+	if _, ok := events[0].Content.Meta["test_suite_id"]; ok {
+		t.Fatal("the suite id must not be sent as a tag")
+	}
+	if events[1].Type != EventTypeSpan || events[1].Content.ParentID != 2 {
+		t.Fatalf("unexpected event: %+v", events[1])
+	}
+}
+
+func TestPayloadMarshalMsg(t *testing.T) {
+	payload := NewPayload([]Event{
+		NewEvent(Span{Name: "go.test_suite", Type: "test_suite_end", Meta: map[string]string{"test_session_id": "1", "test_module_id": "2"}}),
+		NewEvent(Span{Name: "test", Type: "test", SpanID: 4, TraceID: 4, Meta: map[string]string{"runtime-id": "abc"}}),
+	})
+
+	value, rest, err := msgp.ReadIntfBytes(payload.MarshalMsg(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("%d trailing bytes", len(rest))
+	}
+
+	root := value.(map[string]interface{})
+	metadata := root["metadata"].(map[string]interface{})["*"].(map[string]interface{})
+	if metadata["language"] != "go" || metadata["runtime-id"] != "abc" {
+		t.Fatalf("unexpected metadata: %v", metadata)
+	}
+
+	events := root["events"].([]interface{})
+	suite := events[0].(map[string]interface{})["content"].(map[string]interface{})
+	if _, ok := suite["trace_id"]; ok {
+		t.Fatal("suite events must not have a trace id")
+	}
+	if fmt.Sprint(suite["test_module_id"]) != "2" {
+		t.Fatalf("unexpected suite content: %v", suite)
+	}
+	test := events[1].(map[string]interface{})
+	if test["type"] != "test" || fmt.Sprint(test["content"].(map[string]interface{})["span_id"]) != "4" {
+		t.Fatalf("unexpected test event: %v", test)
+	}
+}
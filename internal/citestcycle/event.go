@@ -0,0 +1,133 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package citestcycle
+
+import (
+	"strconv"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+)
+
+// Define the event types of the citestcycle intake.
+const (
+	// EventTypeTest is a test execution.
+	EventTypeTest = "test"
+
+	// EventTypeTestSuite is a finished test suite.
+	EventTypeTestSuite = "test_suite_end"
+
+	// EventTypeTestModule is a finished test module.
+	EventTypeTestModule = "test_module_end"
+
+	// EventTypeTestSession is a finished test session.
+	EventTypeTestSession = "test_session_end"
+
+	// EventTypeSpan is any other span created while running a test.
+	EventTypeSpan = "span"
+)
+
+// Event is a single entry of the events list of a citestcycle payload.
+type Event struct {
+	Type    string  `json:"type"`
+	Version int32   `json:"version"`
+	Content Content `json:"content"`
+}
+
+// Content holds the span data of an event.
+type Content struct {
+	TraceID       uint64             `json:"trace_id,omitempty"`
+	SpanID        uint64             `json:"span_id,omitempty"`
+	ParentID      uint64             `json:"parent_id,omitempty"`
+	TestSessionID uint64             `json:"test_session_id,omitempty"`
+	TestModuleID  uint64             `json:"test_module_id,omitempty"`
+	TestSuiteID   uint64             `json:"test_suite_id,omitempty"`
+	Name          string             `json:"name"`
+	Service       string             `json:"service"`
+	Resource      string             `json:"resource"`
+	Type          string             `json:"type"`
+	Start         int64              `json:"start"`
+	Duration      int64              `json:"duration"`
+	Error         int32              `json:"error"`
+	Meta          map[string]string  `json:"meta,omitempty"`
+	Metrics       map[string]float64 `json:"metrics,omitempty"`
+}
+
+// NewEvent converts a span into its citestcycle event.
+func NewEvent(span Span) Event {
+	event := Event{
+		Type:    EventTypeSpan,
+		Version: 1,
+		Content: Content{
+			Name:     span.Name,
+			Service:  span.Service,
+			Resource: span.Resource,
+			Type:     span.Type,
+			Start:    span.Start,
+			Duration: span.Duration,
+			Error:    span.Error,
+			Meta:     map[string]string{},
+			Metrics:  span.Metrics,
+		},
+	}
+	for k, v := range span.Meta {
+		event.Content.Meta[k] = v
+	}
+
+	switch span.Type {
+	case constants.SpanTypeTest:
+		event.Type = EventTypeTest
+		event.Version = 2
+	case constants.SpanTypeTestSuite:
+		event.Type = EventTypeTestSuite
+	case constants.SpanTypeTestModule:
+		event.Type = EventTypeTestModule
+	case constants.SpanTypeTestSession:
+		event.Type = EventTypeTestSession
+	}
+
+	// Tests and regular spans are identified by their trace, the session, module and suite
+	// events are identified by their own IDs only.
+	if event.Type == EventTypeTest || event.Type == EventTypeSpan {
+		event.Content.TraceID = span.TraceID
+		event.Content.SpanID = span.SpanID
+		event.Content.ParentID = span.ParentID
+	}
+	if event.Type != EventTypeSpan {
+		event.Content.TestSessionID = popID(event.Content.Meta, constants.TestSessionID)
+		event.Content.TestModuleID = popID(event.Content.Meta, constants.TestModuleID)
+		event.Content.TestSuiteID = popID(event.Content.Meta, constants.TestSuiteID)
+	}
+
+	// The ID of a session, module or suite is the ID of its own span.
+	switch event.Type {
+	case EventTypeTestSuite:
+		event.Content.TestSuiteID = span.SpanID
+	case EventTypeTestModule:
+		event.Content.TestModuleID = span.SpanID
+	case EventTypeTestSession:
+		event.Content.TestSessionID = span.SpanID
+	}
+	return event
+}
+
+// NewEvents converts a list of spans into their citestcycle events.
+func NewEvents(spans []Span) []Event {
+	events := make([]Event, 0, len(spans))
+	for _, span := range spans {
+		events = append(events, NewEvent(span))
+	}
+	return events
+}
+
+func popID(meta map[string]string, key string) uint64 {
+	value, ok := meta[key]
+	if !ok {
+		return 0
+	}
+	delete(meta, key)
+	id, _ := strconv.ParseUint(value, 10, 64)
+	return id
+}
@@ -0,0 +1,143 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package citestcycle
+
+import (
+	"os"
+	"sort"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Payload is the body of a request to the citestcycle intake.
+type Payload struct {
+	Version  int32                        `json:"version"`
+	Metadata map[string]map[string]string `json:"metadata"`
+	Events   []Event                      `json:"events"`
+}
+
+// NewPayload returns a payload for the given events with the metadata shared by all of them.
+func NewPayload(events []Event) *Payload {
+	metadata := map[string]string{
+		"language": "go",
+	}
+	if env := os.Getenv("DD_ENV"); env != "" {
+		metadata["env"] = env
+	}
+	for _, event := range events {
+		if id, ok := event.Content.Meta["runtime-id"]; ok {
+			metadata["runtime-id"] = id
+			break
+		}
+	}
+	return &Payload{
+		Version:  1,
+		Metadata: map[string]map[string]string{"*": metadata},
+		Events:   events,
+	}
+}
+
+// MarshalMsg appends the msgpack encoding of the payload to b.
+func (p *Payload) MarshalMsg(b []byte) []byte {
+	b = msgp.AppendMapHeader(b, 3)
+	b = msgp.AppendString(b, "version")
+	b = msgp.AppendInt32(b, p.Version)
+
+	b = msgp.AppendString(b, "metadata")
+	b = msgp.AppendMapHeader(b, uint32(len(p.Metadata)))
+	for _, key := range sortedKeys(p.Metadata) {
+		b = msgp.AppendString(b, key)
+		b = msgp.AppendMapStrStr(b, p.Metadata[key])
+	}
+
+	b = msgp.AppendString(b, "events")
+	b = msgp.AppendArrayHeader(b, uint32(len(p.Events)))
+	for _, event := range p.Events {
+		b = event.MarshalMsg(b)
+	}
+	return b
+}
+
+// MarshalMsg appends the msgpack encoding of the event to b.
+func (e *Event) MarshalMsg(b []byte) []byte {
+	b = msgp.AppendMapHeader(b, 3)
+	b = msgp.AppendString(b, "type")
+	b = msgp.AppendString(b, e.Type)
+	b = msgp.AppendString(b, "version")
+	b = msgp.AppendInt32(b, e.Version)
+	b = msgp.AppendString(b, "content")
+	return e.Content.marshalMsg(b, e.Type)
+}
+
+func (c *Content) marshalMsg(b []byte, eventType string) []byte {
+	ids := []struct {
+		key   string
+		value uint64
+	}{
+		{"test_session_id", c.TestSessionID},
+		{"test_module_id", c.TestModuleID},
+		{"test_suite_id", c.TestSuiteID},
+	}
+	hasTrace := eventType == EventTypeTest || eventType == EventTypeSpan
+
+	fields := uint32(9)
+	if hasTrace {
+		fields += 3
+	}
+	for _, id := range ids {
+		if id.value != 0 {
+			fields++
+		}
+	}
+
+	b = msgp.AppendMapHeader(b, fields)
+	if hasTrace {
+		b = msgp.AppendString(b, "trace_id")
+		b = msgp.AppendUint64(b, c.TraceID)
+		b = msgp.AppendString(b, "span_id")
+		b = msgp.AppendUint64(b, c.SpanID)
+		b = msgp.AppendString(b, "parent_id")
+		b = msgp.AppendUint64(b, c.ParentID)
+	}
+	for _, id := range ids {
+		if id.value != 0 {
+			b = msgp.AppendString(b, id.key)
+			b = msgp.AppendUint64(b, id.value)
+		}
+	}
+	b = msgp.AppendString(b, "name")
+	b = msgp.AppendString(b, c.Name)
+	b = msgp.AppendString(b, "service")
+	b = msgp.AppendString(b, c.Service)
+	b = msgp.AppendString(b, "resource")
+	b = msgp.AppendString(b, c.Resource)
+	b = msgp.AppendString(b, "type")
+	b = msgp.AppendString(b, c.Type)
+	b = msgp.AppendString(b, "start")
+	b = msgp.AppendInt64(b, c.Start)
+	b = msgp.AppendString(b, "duration")
+	b = msgp.AppendInt64(b, c.Duration)
+	b = msgp.AppendString(b, "error")
+	b = msgp.AppendInt32(b, c.Error)
+	b = msgp.AppendString(b, "meta")
+	b = msgp.AppendMapStrStr(b, c.Meta)
+	b = msgp.AppendString(b, "metrics")
+	b = msgp.AppendMapHeader(b, uint32(len(c.Metrics)))
+	for key, value := range c.Metrics {
+		b = msgp.AppendString(b, key)
+		b = msgp.AppendFloat64(b, value)
+	}
+	return b
+}
+
+func sortedKeys(m map[string]map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
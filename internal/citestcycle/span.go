@@ -0,0 +1,162 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package citestcycle
+
+import (
+	"fmt"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Span is a span as encoded by the tracer in the payloads sent to the agent.
+type Span struct {
+	Name     string
+	Service  string
+	Resource string
+	Type     string
+	Start    int64
+	Duration int64
+	Meta     map[string]string
+	Metrics  map[string]float64
+	SpanID   uint64
+	TraceID  uint64
+	ParentID uint64
+	Error    int32
+}
+
+// DecodeTraces decodes a msgpack payload of the agent /v0.4/traces endpoint into the list of
+// the spans of all its traces.
+func DecodeTraces(b []byte) ([]Span, error) {
+	traces, b, err := msgp.ReadArrayHeaderBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read traces: %v", err)
+	}
+
+	var spans []Span
+	for i := uint32(0); i < traces; i++ {
+		var count uint32
+		count, b, err = msgp.ReadArrayHeaderBytes(b)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read trace %d: %v", i, err)
+		}
+		for j := uint32(0); j < count; j++ {
+			var span Span
+			b, err = decodeSpan(b, &span)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read span %d of trace %d: %v", j, i, err)
+			}
+			spans = append(spans, span)
+		}
+	}
+	return spans, nil
+}
+
+func decodeSpan(b []byte, span *Span) ([]byte, error) {
+	fields, b, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	for i := uint32(0); i < fields; i++ {
+		var key []byte
+		key, b, err = msgp.ReadMapKeyZC(b)
+		if err != nil {
+			return b, err
+		}
+		if msgp.IsNil(b) {
+			b, err = msgp.ReadNilBytes(b)
+			if err != nil {
+				return b, err
+			}
+			continue
+		}
+		switch string(key) {
+		case "name":
+			span.Name, b, err = msgp.ReadStringBytes(b)
+		case "service":
+			span.Service, b, err = msgp.ReadStringBytes(b)
+		case "resource":
+			span.Resource, b, err = msgp.ReadStringBytes(b)
+		case "type":
+			span.Type, b, err = msgp.ReadStringBytes(b)
+		case "start":
+			span.Start, b, err = msgp.ReadInt64Bytes(b)
+		case "duration":
+			span.Duration, b, err = msgp.ReadInt64Bytes(b)
+		case "meta":
+			span.Meta, b, err = decodeMeta(b)
+		case "metrics":
+			span.Metrics, b, err = decodeMetrics(b)
+		case "span_id":
+			span.SpanID, b, err = msgp.ReadUint64Bytes(b)
+		case "trace_id":
+			span.TraceID, b, err = msgp.ReadUint64Bytes(b)
+		case "parent_id":
+			span.ParentID, b, err = msgp.ReadUint64Bytes(b)
+		case "error":
+			span.Error, b, err = msgp.ReadInt32Bytes(b)
+		default:
+			b, err = msgp.Skip(b)
+		}
+		if err != nil {
+			return b, fmt.Errorf("field %s: %v", key, err)
+		}
+	}
+	return b, nil
+}
+
+func decodeMeta(b []byte) (map[string]string, []byte, error) {
+	size, b, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return nil, b, err
+	}
+	meta := make(map[string]string, size)
+	for i := uint32(0); i < size; i++ {
+		var key, value string
+		key, b, err = msgp.ReadStringBytes(b)
+		if err != nil {
+			return nil, b, err
+		}
+		value, b, err = msgp.ReadStringBytes(b)
+		if err != nil {
+			return nil, b, err
+		}
+		meta[key] = value
+	}
+	return meta, b, nil
+}
+
+func decodeMetrics(b []byte) (map[string]float64, []byte, error) {
+	size, b, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return nil, b, err
+	}
+	metrics := make(map[string]float64, size)
+	for i := uint32(0); i < size; i++ {
+		var key string
+		key, b, err = msgp.ReadStringBytes(b)
+		if err != nil {
+			return nil, b, err
+		}
+		var value float64
+		switch msgp.NextType(b) {
+		case msgp.IntType:
+			var v int64
+			v, b, err = msgp.ReadInt64Bytes(b)
+			value = float64(v)
+		case msgp.UintType:
+			var v uint64
+			v, b, err = msgp.ReadUint64Bytes(b)
+			value = float64(v)
+		default:
+			value, b, err = msgp.ReadFloat64Bytes(b)
+		}
+		if err != nil {
+			return nil, b, err
+		}
+		metrics[key] = value
+	}
+	return metrics, b, nil
+}
@@ -30,9 +30,24 @@ const (
 	// CIStageName indicates stage name.
 	CIStageName = "ci.stage.name"
 
+	// CINodeName indicates the name of the machine, or runner, where the job ran.
+	CINodeName = "ci.node.name"
+
+	// CINodeLabels indicates the labels of the machine where the job ran, as a JSON array.
+	CINodeLabels = "ci.node.labels"
+
 	// CIWorkspacePath records an absolute path to the directory where the project has been checked out.
 	CIWorkspacePath = "ci.workspace_path"
 
+	// PullRequestNumber indicates the number of the pull request.
+	PullRequestNumber = "pr.number"
+
 	// CIEnvVars contains env vars used to get the pipeline correlation ID
 	CIEnvVars = "_dd.ci.env_vars"
+
+	// CIDiagnostics records, as JSON, how the CI and git tags were detected.
+	CIDiagnostics = "_dd.ci.diagnostics"
+
+	// CIDirectives contains the comma-separated names of the commit message directives applied.
+	CIDirectives = "_dd.ci.directives"
 )
@@ -38,4 +38,51 @@ const (
 
 	// GitTag indicates the current git tag.
 	GitTag = "git.tag"
+
+	// GitCommitHeadSHA indicates the head commit SHA of the pull request, when the commit tested is a
+	// merge of the pull request into its base branch.
+	GitCommitHeadSHA = "git.commit.head_sha"
+
+	// GitPullRequestBaseBranch indicates the base branch of the pull request.
+	GitPullRequestBaseBranch = "git.pull_request.base_branch"
+
+	// GitPullRequestBaseBranchSHA indicates the commit SHA of the base branch of the pull request.
+	GitPullRequestBaseBranchSHA = "git.pull_request.base_branch_sha"
+
+	// GitSubmoduleRepositoryURL indicates the repository URL of the submodule the tests run in, when
+	// GitRepositoryURL is the one of its superproject.
+	GitSubmoduleRepositoryURL = "git.submodule.repository_url"
+
+	// GitSubmoduleCommitSHA indicates the commit SHA of the submodule the tests run in.
+	GitSubmoduleCommitSHA = "git.submodule.commit.sha"
+
+	// GitDirty indicates whether the worktree has uncommitted changes, "true" or "false".
+	GitDirty = "git.dirty"
+
+	// GitDirtyModifiedFiles indicates the number of tracked files with uncommitted changes.
+	GitDirtyModifiedFiles = "git.dirty.modified_files"
+
+	// GitDirtyUntrackedFiles indicates the number of untracked files.
+	GitDirtyUntrackedFiles = "git.dirty.untracked_files"
+
+	// GitDirtyDiffSHA indicates the SHA-256 hash of the uncommitted changes of the tracked files.
+	GitDirtyDiffSHA = "git.dirty.diff_sha"
+
+	// GitUnshallow indicates the outcome of fetching the history of a shallow clone, e.g. GitUnshallowSuccess.
+	GitUnshallow = "_dd.git.unshallow"
+)
+
+// Define the outcomes of fetching the history of a shallow clone.
+const (
+	// GitUnshallowSuccess reports that the history was fetched.
+	GitUnshallowSuccess = "success"
+
+	// GitUnshallowFailure reports that the history could not be fetched.
+	GitUnshallowFailure = "failure"
+
+	// GitUnshallowTimeout reports that fetching the history timed out.
+	GitUnshallowTimeout = "timeout"
+
+	// GitUnshallowDisabled reports that the clone was left shallow because fetching the history is disabled.
+	GitUnshallowDisabled = "disabled"
 )
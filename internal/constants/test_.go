@@ -32,6 +32,27 @@ const (
 
 	// TestSourceEndLine indicates the line of the source file where the test ends.
 	TestSourceEndLine = "test.source.end"
+
+	// TestIsModified indicates that the source of the test changed in the pull request tested.
+	TestIsModified = "test.is_modified"
+
+	// TestModule indicates the test module name.
+	TestModule = "test.module"
+
+	// TestCommand indicates the command used to run the test session.
+	TestCommand = "test.command"
+
+	// TestSessionID links a span with the test session it belongs to.
+	TestSessionID = "test_session_id"
+
+	// TestModuleID links a span with the test module it belongs to.
+	TestModuleID = "test_module_id"
+
+	// TestSuiteID links a span with the test suite it belongs to.
+	TestSuiteID = "test_suite_id"
+
+	// TestUndeliveredPayloads indicates the number of payloads of the test session that could not be delivered.
+	TestUndeliveredPayloads = "test.undelivered_payloads"
 )
 
 // Define valid test status types.
@@ -0,0 +1,48 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+// Package export configures how the tracer exports the test events, shared by ddtesting.Run and
+// the ddtest command.
+package export
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/transport"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// ResolveAgent returns the agent the payloads are sent to, and the tracer options sending the
+// spans to the same agent: the address of cfg.AgentAddr, overridden by DD_AGENT_HOST and
+// DD_TRACE_AGENT_PORT, reached through cfg.HTTPClient. When cfg doesn't configure the agent,
+// DD_TRACE_AGENT_URL is used, or else DD_AGENT_HOST and DD_TRACE_AGENT_PORT.
+func ResolveAgent(cfg Config) (*transport.Agent, []tracer.StartOption) {
+	var agent *transport.Agent
+	if cfg.AgentAddr == "" && cfg.HTTPClient == nil {
+		agent = transport.AgentFromEnv()
+	} else {
+		agent = transport.NewAgent(cfg.AgentAddr, nil)
+		if cfg.HTTPClient != nil {
+			agent.Transport = cfg.HTTPClient.Transport
+			if cfg.HTTPClient.Timeout > 0 {
+				agent.Timeout = cfg.HTTPClient.Timeout
+			}
+		}
+	}
+
+	opts := []tracer.StartOption{tracer.WithAgentAddr(strings.TrimPrefix(agent.URL, "http://"))}
+	client := cfg.HTTPClient
+	if client == nil && agent.Transport != nil {
+		client = &http.Client{
+			Transport: agent.Transport,
+			Timeout:   agent.Timeout,
+		}
+	}
+	if client != nil {
+		opts = append(opts, tracer.WithHTTPClient(client))
+	}
+	return agent, opts
+}
@@ -0,0 +1,57 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package export
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestResolveAgent(t *testing.T) {
+	defer os.Unsetenv("DD_TRACE_AGENT_URL")
+	defer os.Unsetenv("DD_AGENT_HOST")
+	transport := &http.Transport{}
+
+	for _, tt := range []struct {
+		name      string
+		agentURL  string
+		agentHost string
+		cfg       Config
+		url       string
+		transport bool
+		timeout   time.Duration
+		opts      int
+	}{
+		{"default", "", "", Config{}, "http://localhost:8126", false, 2 * time.Second, 1},
+		{"agent address", "", "", Config{AgentAddr: "agent:1234"}, "http://agent:1234", false, 2 * time.Second, 1},
+		{"agent host", "", "other", Config{AgentAddr: "agent:1234"}, "http://other:1234", false, 2 * time.Second, 1},
+		{"http client", "", "", Config{HTTPClient: &http.Client{Transport: transport, Timeout: time.Second}}, "http://localhost:8126", true, time.Second, 2},
+		{"agent url", "http://agent:4321", "", Config{}, "http://agent:4321", false, 2 * time.Second, 1},
+		{"agent url socket", "unix:///var/run/datadog/apm.socket", "", Config{}, "http://localhost:8126", true, 2 * time.Second, 2},
+		{"options over agent url", "http://agent:4321", "", Config{AgentAddr: "agent:1234"}, "http://agent:1234", false, 2 * time.Second, 1},
+		{"invalid agent url", "ftp://agent", "", Config{}, "http://localhost:8126", false, 2 * time.Second, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("DD_TRACE_AGENT_URL", tt.agentURL)
+			os.Setenv("DD_AGENT_HOST", tt.agentHost)
+			agent, opts := ResolveAgent(tt.cfg)
+			if agent.URL != tt.url {
+				t.Errorf("expected the agent at %s, got %s", tt.url, agent.URL)
+			}
+			if (agent.Transport != nil) != tt.transport {
+				t.Errorf("unexpected transport %v", agent.Transport)
+			}
+			if agent.Timeout != tt.timeout {
+				t.Errorf("expected the timeout %s, got %s", tt.timeout, agent.Timeout)
+			}
+			if len(opts) != tt.opts {
+				t.Errorf("expected %d tracer options, got %d", tt.opts, len(opts))
+			}
+		})
+	}
+}
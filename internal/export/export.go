@@ -0,0 +1,204 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package export
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/gitupload"
+	"github.com/DataDog/dd-sdk-go-testing/internal/report"
+	"github.com/DataDog/dd-sdk-go-testing/internal/transport"
+	"github.com/DataDog/dd-sdk-go-testing/internal/utils"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const (
+	// exportTimeout bounds the time the tracer waits for a payload to be exported.
+	exportTimeout = 30 * time.Second
+
+	// drainTimeout bounds the time spent delivering the pending payloads before finishing the session.
+	drainTimeout = 15 * time.Second
+
+	// gitUploadTimeout bounds the time spent uploading the git metadata.
+	gitUploadTimeout = 30 * time.Second
+
+	// DefaultSummarySlowest is the number of slowest tests listed in the summary by default.
+	DefaultSummarySlowest = 5
+)
+
+// Config configures how the test events are exported.
+type Config struct {
+	// OutputFile is the file the events are written to instead of being sent.
+	OutputFile string
+	// JUnitReport is the file, or the directory, the JUnit XML report is written to.
+	JUnitReport string
+	// OTLPEndpoint is the OTLP/HTTP endpoint the spans are sent to instead of Datadog.
+	OTLPEndpoint string
+	// Summary prints a summary of the tests to stderr, listing the SummarySlowest slowest tests.
+	Summary        bool
+	SummarySlowest int
+	// GitUpload uploads the recent commits of the repository, after fetching the history of a
+	// shallow clone if GitUnshallow is set.
+	GitUpload    bool
+	GitUnshallow bool
+	// Retries retries the payloads that couldn't be delivered.
+	Retries bool
+	// AgentAddr and HTTPClient configure the agent the tracer and the SDK send the payloads to.
+	AgentAddr  string
+	HTTPClient *http.Client
+}
+
+// ConfigFromEnv returns the configuration set by the environment.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		OutputFile:     os.Getenv("DD_CIVISIBILITY_OUTPUT_FILE"),
+		JUnitReport:    os.Getenv("DD_CIVISIBILITY_JUNIT_REPORT"),
+		OTLPEndpoint:   os.Getenv("DD_CIVISIBILITY_OTLP_ENDPOINT"),
+		SummarySlowest: DefaultSummarySlowest,
+		GitUpload:      true,
+		Retries:        true,
+	}
+	cfg.Summary, _ = strconv.ParseBool(os.Getenv("DD_CIVISIBILITY_SUMMARY"))
+	if v, err := strconv.Atoi(os.Getenv("DD_CIVISIBILITY_SUMMARY_SLOWEST")); err == nil && v >= 0 {
+		cfg.SummarySlowest = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("DD_CIVISIBILITY_GIT_UPLOAD_ENABLED")); err == nil {
+		cfg.GitUpload = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("DD_CIVISIBILITY_GIT_UNSHALLOW_ENABLED")); err == nil {
+		cfg.GitUnshallow = v
+	}
+	return cfg
+}
+
+// ApplyDirectives adjusts cfg with the directives of the commit message, which take precedence
+// over the options and the environment.
+func (cfg *Config) ApplyDirectives(directives utils.Directives) {
+	if directives.SkipGitUpload {
+		cfg.GitUpload = false
+	}
+	if directives.NoDeliveryRetries {
+		cfg.Retries = false
+	}
+}
+
+// Exporter exports the test events of a run through the tracer, and uploads the git metadata in
+// the background.
+type Exporter struct {
+	opts          []tracer.StartOption
+	rt            *transport.RoundTripper
+	waitGitUpload func() gitupload.Result
+}
+
+// Start starts the tracer with opts, configured to export the test events as set by cfg, and the
+// upload of the git metadata. tags are the CI tags of the run.
+func Start(cfg Config, tags map[string]string, opts ...tracer.StartOption) *Exporter {
+	// Check if DD_SERVICE has been set; otherwise we default to repo name.
+	if v := os.Getenv("DD_SERVICE"); v == "" {
+		if repoUrl := tags[constants.GitRepositoryURL]; repoUrl != "" {
+			opts = append(opts, tracer.WithService(utils.RepositoryName(repoUrl)))
+		}
+	}
+
+	// Send the git metadata and the test events to the agent used by the tracer.
+	agent, agentOpts := ResolveAgent(cfg)
+	opts = append(opts, agentOpts...)
+	e := &Exporter{
+		waitGitUpload: startGitUpload(cfg, agent, tags),
+	}
+
+	rt, timeout := newRoundTripper(cfg, agent)
+	e.rt = rt
+	opts = append(opts, tracer.WithHTTPClient(&http.Client{
+		Transport: rt,
+		Timeout:   timeout,
+	}))
+	e.opts = opts
+	tracer.Start(opts...)
+	return e
+}
+
+// Restart starts the tracer again with the same options, e.g. once a mock tracer stopped it.
+func (e *Exporter) Restart() {
+	tracer.Start(e.opts...)
+}
+
+// WaitGitUpload waits for the upload of the git metadata to complete and returns its outcome.
+func (e *Exporter) WaitGitUpload() gitupload.Result {
+	return e.waitGitUpload()
+}
+
+// Drain flushes the finished spans and waits for the payloads to be delivered, and returns the
+// number of payloads that were not.
+func (e *Exporter) Drain() int {
+	tracer.Flush()
+	return e.rt.Drain(drainTimeout)
+}
+
+// Stop flushes the remaining spans, stops the tracer and closes the exporters.
+func (e *Exporter) Stop() {
+	tracer.Flush()
+	tracer.Stop()
+	e.rt.Close()
+}
+
+// newRoundTripper returns the round tripper the tracer must use to export the test events, and the
+// timeout of its requests. The payloads that can't be delivered are retried from a spool, unless
+// retries are disabled.
+func newRoundTripper(cfg Config, agent *transport.Agent) (*transport.RoundTripper, time.Duration) {
+	spooling := transport.NewSpoolingExporterFromEnv
+	if !cfg.Retries {
+		spooling = func(_ string, exporter transport.Exporter) transport.Exporter { return exporter }
+	}
+
+	var exporters []transport.Exporter
+	if cfg.JUnitReport != "" {
+		exporters = append(exporters, report.NewJUnitReporter(cfg.JUnitReport))
+	}
+	if cfg.Summary {
+		exporters = append(exporters, report.NewSummaryReporter(os.Stderr, cfg.SummarySlowest, os.Getenv("DD_SITE")))
+	}
+
+	if cfg.OutputFile != "" {
+		// Offline mode: the events are only written to disk to be uploaded later on.
+		exporter, err := transport.NewFileExporter(cfg.OutputFile)
+		if err == nil {
+			return transport.NewRoundTripper(nil, append(exporters, exporter)...), exportTimeout
+		}
+		log.Printf("dd-sdk-go-testing: cannot open the output file: %v", err)
+	}
+
+	if cfg.OTLPEndpoint != "" {
+		// The spans are sent to an OpenTelemetry collector instead of Datadog.
+		exporter := spooling("otlp", transport.NewOTLPExporterFromEnv(cfg.OTLPEndpoint))
+		return transport.NewRoundTripper(nil, append(exporters, exporter)...), exportTimeout
+	}
+	if exporter := transport.NewIntakeExporterFromEnv(agent); exporter != nil {
+		exporter = spooling("citestcycle", exporter)
+		return transport.NewRoundTripper(nil, append(exporters, exporter)...), exportTimeout
+	}
+	// The spans are still sent to the agent, through the transport and with the timeout the tracer
+	// would use, and retried when the agent can't take them, e.g. while it restarts.
+	rt := transport.NewForwardingRoundTripper(agent.Transport, exporters...)
+	if !cfg.Retries {
+		rt.DisableRetries()
+	}
+	return rt, agent.Timeout
+}
+
+// startGitUpload uploads the git metadata in the background when the test events are sent to
+// Datadog, and returns a function waiting for the upload to complete.
+func startGitUpload(cfg Config, agent *transport.Agent, tags map[string]string) (wait func() gitupload.Result) {
+	if !cfg.GitUpload || cfg.OutputFile != "" || cfg.OTLPEndpoint != "" {
+		return func() gitupload.Result { return gitupload.Result{} }
+	}
+	return gitupload.Start(agent, tags[constants.GitRepositoryURL], tags[constants.GitCommitSHA], cfg.GitUnshallow, gitUploadTimeout)
+}
@@ -0,0 +1,94 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package export
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/transport"
+	"github.com/DataDog/dd-sdk-go-testing/internal/utils"
+)
+
+func TestNewRoundTripper(t *testing.T) {
+	// An agent without the EVP proxy.
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "dd-sdk-go-testing-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		name    string
+		cfg     Config
+		timeout time.Duration
+	}{
+		// The spans are forwarded to the agent with the timeout of the tracer, and retried.
+		{"agent", Config{Retries: true}, 5 * time.Second},
+		// The spans are forwarded to the agent with the timeout of the tracer.
+		{"junit", Config{JUnitReport: dir, Retries: true}, 5 * time.Second},
+		// The spans are not sent to the agent.
+		{"output file", Config{OutputFile: filepath.Join(dir, "events.ndjson")}, exportTimeout},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := &transport.Agent{URL: srv.URL, Timeout: 5 * time.Second}
+			rt, timeout := newRoundTripper(tt.cfg, agent)
+			if rt == nil || timeout != tt.timeout {
+				t.Fatalf("expected the %v timeout, got %v and %v", tt.timeout, rt, timeout)
+			}
+			rt.Close()
+		})
+	}
+}
+
+func TestNewRoundTripperRetriesAgentPayloads(t *testing.T) {
+	// An agent unavailable for the first payload, as while it restarts.
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	agent := &transport.Agent{URL: srv.URL, Timeout: 5 * time.Second}
+	rt, _ := newRoundTripper(Config{Retries: true}, agent)
+	defer rt.Close()
+	req, err := http.NewRequest("POST", srv.URL+"/v0.4/traces", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := rt.Drain(10 * time.Second); n != 0 {
+		t.Errorf("expected the payload to be delivered, %d undelivered", n)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected the payload to be retried once, got %d requests", n)
+	}
+}
+
+func TestConfigDirectives(t *testing.T) {
+	cfg := Config{GitUpload: true, Retries: true}
+	cfg.ApplyDirectives(utils.ParseDirectives("Fix the build\n\n[dd skip-git-upload] [dd no-delivery-retries]"))
+	if cfg.GitUpload || cfg.Retries {
+		t.Fatalf("expected the directives to disable the git upload and the retries, got %+v", cfg)
+	}
+}
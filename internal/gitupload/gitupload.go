@@ -0,0 +1,246 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+// Package gitupload uploads the recent commits of the local repository that the backend doesn't
+// know yet, so that it can use the commit graph to select the tests impacted by a change.
+package gitupload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/transport"
+	"github.com/DataDog/dd-sdk-go-testing/internal/utils"
+)
+
+const (
+	// since bounds the age of the commits that are uploaded.
+	since = "1 month ago"
+
+	// maxCommits bounds the number of commits searched in the backend.
+	maxCommits = 1000
+
+	// maxPackSize bounds the size of each uploaded pack file.
+	maxPackSize = "3m"
+
+	// lockName is the file, in the git directory, created by the process uploading the git metadata,
+	// so that the test binaries run in parallel, e.g. by go test ./..., upload it once.
+	lockName = "dd-civisibility-git-upload.lock"
+
+	// staleLockAge is the age after which the lock is ignored, e.g. left by a killed process.
+	staleLockAge = 5 * time.Minute
+)
+
+// Result is the outcome of the upload of the git metadata.
+type Result struct {
+	// Unshallow is the outcome of fetching the history of a shallow clone, e.g.
+	// constants.GitUnshallowSuccess, or an empty string if the clone isn't shallow.
+	Unshallow string
+}
+
+// Start uploads the git metadata in the background, to the API configured by the environment or
+// through the agent, and returns a function waiting for the upload to complete. The history of a shallow clone is fetched
+// first if unshallow is set. The upload is canceled once the timeout expires, and failures are only
+// logged, as they must not affect the tests.
+func Start(agent *transport.Agent, repositoryURL, headSha string, unshallow bool, timeout time.Duration) (wait func() Result) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	done := make(chan struct{})
+	var result Result
+	go func() {
+		defer close(done)
+		client := transport.NewGitMetadataClientFromEnv(agent)
+		if client == nil {
+			return
+		}
+		var err error
+		if result, err = Upload(ctx, client, repositoryURL, headSha, unshallow); err != nil {
+			log.Printf("dd-sdk-go-testing: cannot upload the git metadata: %v", err)
+		}
+	}()
+	return func() Result {
+		<-done
+		cancel()
+		return result
+	}
+}
+
+// Upload uploads the objects of the recent commits of the repository of the working directory, or
+// of its superproject if it is a submodule, that the backend doesn't know yet, up to headSha. The history of a shallow clone is fetched first if
+// unshallow is set, as the missing commits would be ignored otherwise. It does nothing without the
+// git binary, or while another process uploads the commits of the same repository.
+func Upload(ctx context.Context, client *transport.GitMetadataClient, repositoryURL, headSha string, unshallow bool) (Result, error) {
+	var result Result
+	if repositoryURL == "" || headSha == "" {
+		return result, nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return result, nil
+	}
+
+	dir := utils.LocalGitRoot()
+	if dir == "" {
+		return result, nil
+	}
+	unlock, err := lock(ctx, dir)
+	if err != nil {
+		return result, err
+	}
+	if unlock == nil {
+		// Another test binary of the repository is uploading the same commits.
+		return result, nil
+	}
+	defer unlock()
+	if utils.IsShallowClone() {
+		result.Unshallow = fetchHistory(ctx, unshallow)
+	}
+
+	out, err := git(ctx, dir, nil, "log", "--format=%H", fmt.Sprintf("-n%d", maxCommits), "--since="+since)
+	if err != nil {
+		return result, err
+	}
+	commits := strings.Fields(string(out))
+	if len(commits) == 0 {
+		return result, nil
+	}
+	known, err := client.SearchCommits(ctx, repositoryURL, commits)
+	if err != nil {
+		return result, err
+	}
+	missing := missingCommits(commits, known)
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	tmp, err := ioutil.TempDir("", "dd-civisibility-packfiles")
+	if err != nil {
+		return result, err
+	}
+	defer os.RemoveAll(tmp)
+	packs, err := packObjects(ctx, dir, tmp, missing, known)
+	if err != nil {
+		return result, err
+	}
+	for _, pack := range packs {
+		if err := client.UploadPackfile(ctx, repositoryURL, headSha, pack); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// lock creates the lock file of the upload in the git directory of the repository of dir and returns
+// a function removing it, or nil if another process holds the lock.
+func lock(ctx context.Context, dir string) (unlock func(), err error) {
+	out, err := git(ctx, dir, nil, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return nil, err
+	}
+	gitDir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+	path := filepath.Join(gitDir, lockName)
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+		os.Remove(path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(f, os.Getpid())
+	f.Close()
+	return func() { os.Remove(path) }, nil
+}
+
+// fetchHistory fetches the history of a shallow clone, if enabled, and returns the outcome.
+func fetchHistory(ctx context.Context, enabled bool) string {
+	if !enabled {
+		return constants.GitUnshallowDisabled
+	}
+	err := utils.Unshallow(ctx)
+	switch {
+	case err == nil:
+		return constants.GitUnshallowSuccess
+	case ctx.Err() == context.DeadlineExceeded:
+		log.Printf("dd-sdk-go-testing: fetching the history of the shallow clone timed out")
+		return constants.GitUnshallowTimeout
+	default:
+		log.Printf("dd-sdk-go-testing: cannot fetch the history of the shallow clone: %v", err)
+		return constants.GitUnshallowFailure
+	}
+}
+
+// missingCommits returns the commits that aren't known.
+func missingCommits(commits, known []string) []string {
+	isKnown := make(map[string]bool, len(known))
+	for _, sha := range known {
+		isKnown[sha] = true
+	}
+	var missing []string
+	for _, sha := range commits {
+		if !isKnown[sha] {
+			missing = append(missing, sha)
+		}
+	}
+	return missing
+}
+
+// packObjects writes the objects of the missing commits of the repository of dir, except the blobs
+// and the objects reachable from the known commits, to pack files in tmp and returns their paths.
+func packObjects(ctx context.Context, dir, tmp string, missing, known []string) ([]string, error) {
+	// The revisions are passed on the standard input, as they could exceed the length limit of the
+	// command line, e.g. on Windows.
+	var revisions bytes.Buffer
+	for _, sha := range missing {
+		fmt.Fprintln(&revisions, sha)
+	}
+	for _, sha := range known {
+		fmt.Fprintln(&revisions, "^"+sha)
+	}
+	objects, err := git(ctx, dir, bytes.NewReader(revisions.Bytes()),
+		"rev-list", "--objects", "--no-object-names", "--filter=blob:none", "--since="+since, "--stdin")
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Join(tmp, "objects")
+	out, err := git(ctx, dir, bytes.NewReader(objects), "pack-objects", "--compression=9", "--max-pack-size="+maxPackSize, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var packs []string
+	for _, hash := range strings.Fields(string(out)) {
+		packs = append(packs, fmt.Sprintf("%s-%s.pack", prefix, hash))
+	}
+	return packs, nil
+}
+
+// git runs a git command in dir and returns its output.
+func git(ctx context.Context, dir string, stdin *bytes.Reader, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
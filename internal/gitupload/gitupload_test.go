@@ -0,0 +1,228 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package gitupload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/testutil"
+	"github.com/DataDog/dd-sdk-go-testing/internal/transport"
+)
+
+const repositoryURL = "https://github.com/DataDog/example.git"
+
+// api is a stand-in of the git metadata API knowing the given commits.
+type api struct {
+	known    map[string]bool
+	searched []string
+	pushed   []string
+	packs    [][]byte
+}
+
+func (a *api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/v2/git/repository/search_commits":
+		var req struct {
+			Meta struct {
+				RepositoryURL string `json:"repository_url"`
+			} `json:"meta"`
+			Data []struct {
+				ID   string `json:"id"`
+				Type string `json:"type"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Meta.RepositoryURL != repositoryURL {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		var known []string
+		for _, commit := range req.Data {
+			a.searched = append(a.searched, commit.ID)
+			if a.known[commit.ID] {
+				known = append(known, fmt.Sprintf(`{"id":%q,"type":"commit"}`, commit.ID))
+			}
+		}
+		fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(known, ","))
+	case "/api/v2/git/repository/packfile":
+		var pushed struct {
+			Data struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(r.FormValue("pushedSha")), &pushed); err != nil {
+			http.Error(w, "invalid pushedSha", http.StatusBadRequest)
+			return
+		}
+		f, _, err := r.FormFile("packfile")
+		if err != nil {
+			http.Error(w, "invalid packfile", http.StatusBadRequest)
+			return
+		}
+		pack, _ := ioutil.ReadAll(f)
+		a.pushed = append(a.pushed, pushed.Data.ID)
+		a.packs = append(a.packs, pack)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	dir, cleanup := testutil.NewRepository(t, 3)
+	defer cleanup()
+	commits := strings.Fields(testutil.Git(t, dir, "log", "--format=%H"))
+	head, first := commits[0], commits[2]
+	defer testutil.Chdir(t, dir)()
+
+	a := &api{known: map[string]bool{first: true}}
+	srv := httptest.NewServer(a)
+	defer srv.Close()
+	client := transport.NewGitMetadataClient(srv.URL+"/api/v2/git/repository", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := Upload(ctx, client, repositoryURL, head, false); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(a.searched, " ") != strings.Join(commits, " ") {
+		t.Fatalf("expected a search of %v, got %v", commits, a.searched)
+	}
+	if len(a.packs) != 1 || a.pushed[0] != head {
+		t.Fatalf("expected a pack file pushed for %s, got %v", head, a.pushed)
+	}
+
+	// The pack file holds the commits and the trees unknown to the backend, without the blobs.
+	packPath := filepath.Join(dir, "uploaded.pack")
+	if err := ioutil.WriteFile(packPath, a.packs[0], 0644); err != nil {
+		t.Fatal(err)
+	}
+	testutil.Git(t, dir, "index-pack", packPath)
+	objects := testutil.Git(t, dir, "verify-pack", "-v", packPath)
+	for _, sha := range commits[:2] {
+		if !strings.Contains(objects, sha+" commit") {
+			t.Errorf("commit %s is missing from the pack:\n%s", sha, objects)
+		}
+	}
+	if strings.Contains(objects, first) || strings.Contains(objects, " blob ") {
+		t.Errorf("unexpected objects in the pack:\n%s", objects)
+	}
+
+	// Nothing is uploaded once the backend knows all the commits.
+	for _, sha := range commits {
+		a.known[sha] = true
+	}
+	a.packs = nil
+	if _, err := Upload(ctx, client, repositoryURL, head, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.packs) != 0 {
+		t.Fatalf("expected no pack file, got %d", len(a.packs))
+	}
+}
+
+func TestUploadLock(t *testing.T) {
+	dir, cleanup := testutil.NewRepository(t, 3)
+	defer cleanup()
+	head := strings.Fields(testutil.Git(t, dir, "log", "--format=%H"))[0]
+	defer testutil.Chdir(t, dir)()
+
+	a := &api{known: map[string]bool{}}
+	srv := httptest.NewServer(a)
+	defer srv.Close()
+	client := transport.NewGitMetadataClient(srv.URL+"/api/v2/git/repository", nil)
+
+	// The commits are uploaded by the process holding the lock.
+	path := filepath.Join(dir, ".git", lockName)
+	if err := ioutil.WriteFile(path, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Upload(context.Background(), client, repositoryURL, head, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.searched) != 0 {
+		t.Fatalf("expected no search while the lock is held, got %v", a.searched)
+	}
+
+	// A stale lock is ignored, and the lock is released once the upload completes.
+	stale := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(path, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Upload(context.Background(), client, repositoryURL, head, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.packs) != 1 {
+		t.Fatalf("expected a pack file once the lock is stale, got %d", len(a.packs))
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the lock to be released, got %v", err)
+	}
+}
+
+func TestUploadShallowClone(t *testing.T) {
+	origin, cleanup := testutil.NewRepository(t, 3)
+	defer cleanup()
+	clone := origin + "-clone"
+	defer os.RemoveAll(clone)
+
+	srv := httptest.NewServer(&api{known: map[string]bool{}})
+	defer srv.Close()
+	client := transport.NewGitMetadataClient(srv.URL+"/api/v2/git/repository", nil)
+
+	for _, tt := range []struct {
+		unshallow bool
+		expected  string
+		commits   int
+	}{
+		{false, constants.GitUnshallowDisabled, 1},
+		{true, constants.GitUnshallowSuccess, 3},
+	} {
+		os.RemoveAll(clone)
+		testutil.Git(t, origin, "clone", "-q", "--depth=1", "file://"+origin, clone)
+		head := strings.TrimSpace(testutil.Git(t, clone, "rev-parse", "HEAD"))
+
+		restore := testutil.Chdir(t, clone)
+		result, err := Upload(context.Background(), client, repositoryURL, head, tt.unshallow)
+		restore()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Unshallow != tt.expected {
+			t.Errorf("expected the %s outcome, got %q", tt.expected, result.Unshallow)
+		}
+		if commits := strings.Fields(testutil.Git(t, clone, "log", "--format=%H")); len(commits) != tt.commits {
+			t.Errorf("expected %d commits once unshallow is %v, got %d", tt.commits, tt.unshallow, len(commits))
+		}
+	}
+}
+
+func TestUploadError(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	client := transport.NewGitMetadataClient(srv.URL, nil)
+
+	_, err := Upload(context.Background(), client, repositoryURL, "HEAD", false)
+	if err == nil || !strings.Contains(err.Error(), "403 Forbidden: forbidden") {
+		t.Fatalf("expected a forbidden error, got %v", err)
+	}
+}
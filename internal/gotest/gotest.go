@@ -0,0 +1,307 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+// Package gotest converts the `go test -json` event stream into test spans, so that tests can be
+// instrumented without changing their code.
+package gotest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/testspan"
+	"github.com/DataDog/dd-sdk-go-testing/internal/utils"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// crashMessage is the error message of the tests that never finished.
+const crashMessage = "test binary crashed"
+
+// Event is an event of the `go test -json` stream, as described by `go doc test2json`.
+type Event struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// Converter creates the session, module, suite and test spans described by the events of a
+// `go test -json` stream. As for a test binary, the module and the suite of a test are named
+// after its package.
+type Converter struct {
+	command     string
+	tags        map[string]string
+	sessionTags map[string]interface{}
+	session     ddtrace.Span
+	status      string
+	packages    map[string]*testPackage
+	last        time.Time
+	diff        utils.GitDiff
+
+	// packageDir returns the directory of a package, to locate the source of its tests.
+	packageDir func(pkg string) string
+}
+
+type testPackage struct {
+	name   string
+	dir    string
+	start  time.Time
+	module ddtrace.Span
+	suite  ddtrace.Span
+	status string
+	tests  map[string]*test
+	output []string
+}
+
+type test struct {
+	span   ddtrace.Span
+	output []string
+}
+
+// NewConverter returns a converter tagging the spans with the given CI tags. command is the
+// go test command line producing the events. The changes of the pull request tested, if any,
+// are computed before the tests start.
+func NewConverter(command string, tags map[string]string) *Converter {
+	return &Converter{
+		command:     command,
+		tags:        tags,
+		sessionTags: map[string]interface{}{},
+		packages:    map[string]*testPackage{},
+		diff:        testspan.GitDiff(tags),
+		packageDir:  goListDir,
+	}
+}
+
+// Failed reports whether a test or a package of the stream failed.
+func (c *Converter) Failed() bool {
+	return c.status == constants.TestStatusFail
+}
+
+// SetSessionTag sets a tag on the session span only.
+func (c *Converter) SetSessionTag(key string, value interface{}) {
+	c.sessionTags[key] = value
+	if c.session != nil {
+		c.session.SetTag(key, value)
+	}
+}
+
+// Convert reads the `go test -json` stream from r, writes the test output to w as go test would
+// without -json and processes the events with c.
+func Convert(r io.Reader, w io.Writer, c *Converter) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var ev Event
+		if len(line) == 0 || line[0] != '{' || json.Unmarshal(line, &ev) != nil {
+			// Not an event, e.g. a build error.
+			fmt.Fprintf(w, "%s\n", line)
+			continue
+		}
+		io.WriteString(w, ev.Output)
+		c.Process(ev)
+	}
+	return scanner.Err()
+}
+
+// Process handles a single event of the stream.
+func (c *Converter) Process(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	c.last = ev.Time
+	if ev.Package == "" {
+		return
+	}
+	if c.session == nil {
+		opts := c.spanOptions(constants.SpanTypeTestSession, ev.Time,
+			tracer.ResourceName(c.command),
+			tracer.Tag(constants.TestCommand, c.command),
+		)
+		for k, v := range c.sessionTags {
+			opts = append(opts, tracer.Tag(k, v))
+		}
+		c.session = tracer.StartSpan("go.test_session", opts...)
+	}
+	p, ok := c.packages[ev.Package]
+	if !ok {
+		p = &testPackage{
+			name:  ev.Package,
+			start: ev.Time,
+			tests: map[string]*test{},
+		}
+		c.packages[ev.Package] = p
+	}
+
+	switch ev.Action {
+	case "run":
+		if ev.Test != "" {
+			c.startTest(p, ev)
+		}
+	case "output":
+		if t, ok := p.tests[ev.Test]; ok {
+			t.output = append(t.output, ev.Output)
+		} else if ev.Test == "" {
+			p.output = append(p.output, ev.Output)
+		}
+	case "pass", "fail", "skip":
+		if ev.Test == "" {
+			c.finishPackage(p, ev.Action, ev.Time)
+		} else if t, ok := p.tests[ev.Test]; ok {
+			c.finishTest(p, ev.Test, t, ev.Action, ev.Time)
+		}
+	}
+}
+
+// FinishPackages finishes the spans of the packages that never ended.
+func (c *Converter) FinishPackages() {
+	for _, p := range c.packages {
+		c.finishPackage(p, constants.TestStatusFail, c.last)
+	}
+}
+
+// Finish finishes the spans of the packages that never ended, then the session span.
+func (c *Converter) Finish() {
+	c.FinishPackages()
+	if c.session != nil {
+		testspan.Finish(c.session, c.status, "", c.last)
+		c.session = nil
+	}
+}
+
+func (c *Converter) spanOptions(spanType string, start time.Time, opts ...ddtrace.StartSpanOption) []ddtrace.StartSpanOption {
+	return testspan.Options(spanType, c.tags, append([]ddtrace.StartSpanOption{tracer.StartTime(start)}, opts...)...)
+}
+
+// startPackage starts the module and suite spans of a package once it runs a test.
+func (c *Converter) startPackage(p *testPackage) {
+	if p.module != nil {
+		return
+	}
+	p.dir = c.packageDir(p.name)
+	p.module = tracer.StartSpan("go.test_module", c.spanOptions(constants.SpanTypeTestModule, p.start,
+		tracer.ResourceName(p.name),
+		tracer.Tag(constants.TestModule, p.name),
+		tracer.Tag(constants.TestSessionID, testspan.FormatID(c.session.Context().SpanID())),
+	)...)
+	p.suite = tracer.StartSpan("go.test_suite", c.spanOptions(constants.SpanTypeTestSuite, p.start,
+		tracer.ResourceName(p.name),
+		tracer.Tag(constants.TestSuite, p.name),
+		tracer.Tag(constants.TestModule, p.name),
+		tracer.Tag(constants.TestSessionID, testspan.FormatID(c.session.Context().SpanID())),
+		tracer.Tag(constants.TestModuleID, testspan.FormatID(p.module.Context().SpanID())),
+	)...)
+}
+
+func (c *Converter) startTest(p *testPackage, ev Event) {
+	c.startPackage(p)
+
+	testType := constants.TestTypeTest
+	if strings.HasPrefix(ev.Test, "Benchmark") {
+		testType = constants.TestTypeBenchmark
+	}
+	opts := c.spanOptions(constants.SpanTypeTest, ev.Time,
+		tracer.ResourceName(fmt.Sprintf("%s.%s", p.name, ev.Test)),
+		tracer.Tag(constants.TestName, ev.Test),
+		tracer.Tag(constants.TestSuite, p.name),
+		tracer.Tag(constants.TestType, testType),
+		tracer.Tag(constants.TestModule, p.name),
+		tracer.Tag(constants.TestSessionID, testspan.FormatID(c.session.Context().SpanID())),
+		tracer.Tag(constants.TestModuleID, testspan.FormatID(p.module.Context().SpanID())),
+		tracer.Tag(constants.TestSuiteID, testspan.FormatID(p.suite.Context().SpanID())),
+	)
+	if p.dir != "" {
+		if file, start, end := utils.GetTestSourceRange(p.dir, ev.Test); file != "" {
+			opts = append(opts, testspan.SourceOptions(file, start, end, c.tags, c.diff)...)
+		}
+	}
+	// Subtests are children of their parent test, as with t.Run.
+	if i := strings.LastIndexByte(ev.Test, '/'); i > 0 {
+		if parent, ok := p.tests[ev.Test[:i]]; ok {
+			opts = append(opts, tracer.ChildOf(parent.span.Context()))
+		}
+	}
+	p.tests[ev.Test] = &test{span: tracer.StartSpan(constants.SpanTypeTest, opts...)}
+}
+
+func (c *Converter) finishTest(p *testPackage, name string, t *test, status string, end time.Time) {
+	switch status {
+	case constants.TestStatusFail:
+		testspan.Finish(t.span, status, message(t.output), end)
+	case constants.TestStatusSkip:
+		if reason := message(t.output); reason != "" {
+			t.span.SetTag(constants.TestSkipReason, reason)
+		}
+		testspan.Finish(t.span, status, "", end)
+	default:
+		testspan.Finish(t.span, status, "", end)
+	}
+	delete(p.tests, name)
+	p.status = testspan.MergeStatus(p.status, status)
+}
+
+func (c *Converter) finishPackage(p *testPackage, status string, end time.Time) {
+	defer delete(c.packages, p.name)
+	output := message(p.output)
+
+	// The tests still running when the package ends were interrupted by a crash or a timeout.
+	for name, t := range p.tests {
+		msg := output
+		if msg == "" {
+			msg = crashMessage
+		}
+		t.output = []string{msg}
+		c.finishTest(p, name, t, constants.TestStatusFail, end)
+	}
+
+	if p.module == nil {
+		if status != constants.TestStatusFail {
+			// Packages without tests don't produce any span.
+			return
+		}
+		// The package failed before running any test, e.g. it doesn't build.
+		c.startPackage(p)
+	}
+	if status == constants.TestStatusFail {
+		p.status = constants.TestStatusFail
+	}
+	testspan.Finish(p.suite, p.status, "", end)
+	testspan.Finish(p.module, p.status, output, end)
+	c.status = testspan.MergeStatus(c.status, p.status)
+}
+
+// message returns the output of a test without the lines added by go test.
+func message(output []string) string {
+	var lines []string
+	for _, out := range output {
+		for _, line := range strings.Split(out, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || line == "PASS" || line == "FAIL" || strings.HasPrefix(line, "=== ") ||
+				strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "ok ") || strings.HasPrefix(line, "FAIL\t") {
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// goListDir returns the directory of the package, or an empty string if go list can't find it.
+func goListDir(pkg string) string {
+	out, err := exec.Command("go", "list", "-f", "{{.Dir}}", pkg).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,145 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package gotest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/testspan"
+	"github.com/DataDog/dd-sdk-go-testing/internal/utils"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+func TestConvert(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	f, err := os.Open("testdata/stream.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	root, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(root, "pkg", "pkg_test.go")
+
+	var out bytes.Buffer
+	c := NewConverter("go test ./...", map[string]string{
+		constants.CIProviderName:  "github",
+		constants.CIWorkspacePath: root,
+	})
+	c.diff = utils.GitDiff{source: {{Start: 10, End: 10}}}
+	c.packageDir = func(pkg string) string {
+		if pkg == "example.com/pkg" {
+			return filepath.Join(root, "pkg")
+		}
+		return ""
+	}
+	if err := Convert(f, &out, c); err != nil {
+		t.Fatal(err)
+	}
+	c.Finish()
+	if !c.Failed() {
+		t.Error("the stream should have failed")
+	}
+
+	if !strings.Contains(out.String(), "    pkg_test.go:30: expected 1, got 2\n--- FAIL: TestC (1.00s)\n") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	spans := map[string]mocktracer.Span{}
+	for _, span := range mt.FinishedSpans() {
+		key := span.Tag(ext.SpanType).(string)
+		if name, ok := span.Tag(constants.TestName).(string); ok {
+			key = name
+		} else if suite, ok := span.Tag(constants.TestModule).(string); ok {
+			key += " " + suite
+		}
+		spans[key] = span
+	}
+	if len(spans) != 10 {
+		t.Fatalf("expected 10 spans, got %d: %v", len(spans), spans)
+	}
+
+	session := spans[constants.SpanTypeTestSession]
+	if session.Tag(constants.TestStatus) != constants.TestStatusFail || session.Tag(constants.TestCommand) != "go test ./..." {
+		t.Errorf("unexpected session tags: %v", session.Tags())
+	}
+	for _, key := range []string{"TestA", "TestA/sub", "TestB", "TestC", "TestD", "test_module_end example.com/pkg", "test_suite_end example.com/crash"} {
+		span, ok := spans[key]
+		if !ok {
+			t.Fatalf("missing span %s", key)
+		}
+		if span.Tag(constants.CIProviderName) != "github" || span.Tag(constants.Origin) != constants.CIAppTestOrigin {
+			t.Errorf("missing CI tags on %s: %v", key, span.Tags())
+		}
+	}
+
+	for name, expected := range map[string]string{
+		"TestA":     constants.TestStatusPass,
+		"TestA/sub": constants.TestStatusPass,
+		"TestB":     constants.TestStatusSkip,
+		"TestC":     constants.TestStatusFail,
+		"TestD":     constants.TestStatusFail,
+	} {
+		span := spans[name]
+		if span.Tag(constants.TestStatus) != expected {
+			t.Errorf("expected status %s for %s, got %v", expected, name, span.Tag(constants.TestStatus))
+		}
+		if span.Tag(constants.TestSessionID) != testspan.FormatID(session.SpanID()) {
+			t.Errorf("%s is not linked to the session", name)
+		}
+	}
+
+	testA, sub := spans["TestA"], spans["TestA/sub"]
+	if sub.ParentID() != testA.SpanID() {
+		t.Error("the subtest should be a child of its parent test")
+	}
+	if testA.Tag(ext.ResourceName) != "example.com/pkg.TestA" || testA.Tag(constants.TestSuite) != "example.com/pkg" {
+		t.Errorf("unexpected test tags: %v", testA.Tags())
+	}
+	if d := testA.FinishTime().Sub(testA.StartTime()); d != time.Second {
+		t.Errorf("unexpected duration %s", d)
+	}
+	if reason := spans["TestB"].Tag(constants.TestSkipReason); reason != "pkg_test.go:20: not on this platform" {
+		t.Errorf("unexpected skip reason %v", reason)
+	}
+	if msg := spans["TestC"].Tag(ext.ErrorMsg); msg != "pkg_test.go:30: expected 1, got 2" {
+		t.Errorf("unexpected error message %v", msg)
+	}
+	if msg := spans["TestD"].Tag(ext.ErrorMsg); msg != "panic: boom" {
+		t.Errorf("unexpected error message %v", msg)
+	}
+	for name, expected := range map[string][]interface{}{
+		"TestA":     {"pkg/pkg_test.go", 5, 8, nil},
+		"TestA/sub": {"pkg/pkg_test.go", 5, 8, nil},
+		"TestB":     {"pkg/pkg_test.go", 10, 12, "true"},
+		"TestC":     {nil, nil, nil, nil},
+	} {
+		span := spans[name]
+		got := []interface{}{span.Tag(constants.TestSourceFile), span.Tag(constants.TestSourceStartLine),
+			span.Tag(constants.TestSourceEndLine), span.Tag(constants.TestIsModified)}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Errorf("expected source tags %v for %s, got %v", expected, name, got)
+				break
+			}
+		}
+	}
+	if _, ok := spans["test_module_end example.com/empty"]; ok {
+		t.Error("packages without tests should not produce spans")
+	}
+}
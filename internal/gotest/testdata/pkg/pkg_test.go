@@ -0,0 +1,12 @@
+package pkg
+
+import "testing"
+
+func TestA(t *testing.T) {
+	t.Run("sub", func(t *testing.T) {
+	})
+}
+
+func TestB(t *testing.T) {
+	t.Skip("not on this platform")
+}
@@ -0,0 +1,185 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/citestcycle"
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Content string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// JUnitReporter collects the test events and writes them as a JUnit XML report when closed.
+type JUnitReporter struct {
+	mu     sync.Mutex
+	path   string
+	module string
+	tests  []citestcycle.Event
+}
+
+// NewJUnitReporter returns a reporter writing the JUnit XML report to path. When path is an
+// existing directory, the report is written to a file named after the test module inside it,
+// so the test binaries of several packages don't overwrite each other's report.
+func NewJUnitReporter(path string) *JUnitReporter {
+	return &JUnitReporter{path: path}
+}
+
+// Export implements transport.Exporter.
+func (r *JUnitReporter) Export(events []citestcycle.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, event := range events {
+		switch event.Type {
+		case citestcycle.EventTypeTest:
+			r.tests = append(r.tests, event)
+			if r.module == "" {
+				r.module = event.Content.Meta[constants.TestModule]
+			}
+		case citestcycle.EventTypeTestModule:
+			r.module = event.Content.Meta[constants.TestModule]
+		}
+	}
+	return nil
+}
+
+// Close implements transport.Exporter.
+func (r *JUnitReporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := xml.MarshalIndent(newJUnitTestSuites(r.tests), "", "  ")
+	if err != nil {
+		return err
+	}
+	path := r.path
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		module := r.module
+		if module == "" {
+			module = filepath.Base(os.Args[0])
+		}
+		path = filepath.Join(path, fmt.Sprintf("junit-%s.xml", unsafeFileChars.ReplaceAllString(module, "_")))
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
+
+func newJUnitTestSuites(tests []citestcycle.Event) junitTestSuites {
+	sort.SliceStable(tests, func(i, j int) bool {
+		return tests[i].Content.Start < tests[j].Content.Start
+	})
+
+	suites := map[string]*junitTestSuite{}
+	durations := map[string]int64{}
+	var names []string
+	for _, test := range tests {
+		meta := test.Content.Meta
+		name := meta[constants.TestSuite]
+		suite, ok := suites[name]
+		if !ok {
+			suite = &junitTestSuite{
+				Name:      name,
+				Timestamp: time.Unix(0, test.Content.Start).UTC().Format("2006-01-02T15:04:05"),
+			}
+			suites[name] = suite
+			names = append(names, name)
+		}
+
+		testCase := junitTestCase{
+			// Subtests are flattened, their name already contains the name of their parents.
+			Name:      meta[constants.TestName],
+			Classname: name,
+			Time:      formatSeconds(test.Content.Duration),
+		}
+		switch meta[constants.TestStatus] {
+		case constants.TestStatusFail:
+			message := meta["error.msg"]
+			if message == "" {
+				message = "Failed"
+			}
+			testCase.Failure = &junitFailure{
+				Message: message,
+				Type:    meta["error.type"],
+				Content: meta["error.stack"],
+			}
+			suite.Failures++
+		case constants.TestStatusSkip:
+			testCase.Skipped = &junitSkipped{Message: meta[constants.TestSkipReason]}
+			suite.Skipped++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+		if !strings.Contains(testCase.Name, "/") {
+			// The duration of a test already includes the duration of its subtests.
+			durations[name] += test.Content.Duration
+		}
+	}
+
+	sort.Strings(names)
+	result := junitTestSuites{}
+	var total int64
+	for _, name := range names {
+		suite := suites[name]
+		suite.Time = formatSeconds(durations[name])
+		result.Tests += suite.Tests
+		result.Failures += suite.Failures
+		result.Skipped += suite.Skipped
+		result.Suites = append(result.Suites, *suite)
+		total += durations[name]
+	}
+	result.Time = formatSeconds(total)
+	return result
+}
+
+func formatSeconds(nanoseconds int64) string {
+	return fmt.Sprintf("%.3f", time.Duration(nanoseconds).Seconds())
+}
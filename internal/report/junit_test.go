@@ -0,0 +1,86 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package report
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/citestcycle"
+)
+
+func testEvent(suite, name, status string, start, duration time.Duration, meta map[string]string) citestcycle.Event {
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	meta["test.suite"] = suite
+	meta["test.name"] = name
+	meta["test.status"] = status
+	meta["test.module"] = suite
+	return citestcycle.Event{
+		Type:    citestcycle.EventTypeTest,
+		Version: 2,
+		Content: citestcycle.Content{
+			Start:    int64(start),
+			Duration: int64(duration),
+			Meta:     meta,
+		},
+	}
+}
+
+func TestJUnitReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ddtesting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reporter := NewJUnitReporter(dir)
+	reporter.Export([]citestcycle.Event{
+		testEvent("github.com/org/pkg", "TestA/sub", "pass", 2, time.Second, nil),
+		testEvent("github.com/org/pkg", "TestB", "fail", 4, time.Millisecond, map[string]string{"error.msg": "forced panic", "error.type": "panic", "error.stack": "main.go:1"}),
+	})
+	reporter.Export([]citestcycle.Event{
+		testEvent("github.com/org/pkg", "TestA", "pass", 1, 2*time.Second, nil),
+		testEvent("github.com/org/pkg", "TestC", "skip", 5, 0, map[string]string{"test.skip_reason": "not today"}),
+	})
+	if err := reporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "junit-github.com_org_pkg.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report junitTestSuites
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Tests != 4 || report.Failures != 1 || report.Skipped != 1 || len(report.Suites) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	suite := report.Suites[0]
+	if suite.Name != "github.com/org/pkg" || suite.Time != "2.001" {
+		t.Fatalf("unexpected suite: %+v", suite)
+	}
+	names := []string{"TestA", "TestA/sub", "TestB", "TestC"}
+	for i, testCase := range suite.Cases {
+		if testCase.Name != names[i] {
+			t.Fatalf("expected %s, got %s", names[i], testCase.Name)
+		}
+	}
+	if failure := suite.Cases[2].Failure; failure == nil || failure.Message != "forced panic" || failure.Content != "main.go:1" {
+		t.Fatalf("unexpected failure: %+v", failure)
+	}
+	if skipped := suite.Cases[3].Skipped; skipped == nil || skipped.Message != "not today" {
+		t.Fatalf("unexpected skip: %+v", skipped)
+	}
+}
@@ -0,0 +1,190 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package report
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/citestcycle"
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+)
+
+// SummaryReporter collects the test events and prints a human-readable summary of the
+// test session when closed.
+type SummaryReporter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	slowest int
+	site    string
+	tests   []citestcycle.Event
+	session *citestcycle.Event
+}
+
+// NewSummaryReporter returns a reporter writing the summary to w, listing the given number
+// of slowest tests. The session URL points to the given Datadog site.
+func NewSummaryReporter(w io.Writer, slowest int, site string) *SummaryReporter {
+	return &SummaryReporter{
+		w:       w,
+		slowest: slowest,
+		site:    site,
+	}
+}
+
+// Export implements transport.Exporter.
+func (r *SummaryReporter) Export(events []citestcycle.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, event := range events {
+		switch event.Type {
+		case citestcycle.EventTypeTest:
+			r.tests = append(r.tests, event)
+		case citestcycle.EventTypeTestSession:
+			r.session = &events[i]
+		}
+	}
+	return nil
+}
+
+// Close implements transport.Exporter.
+func (r *SummaryReporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	statuses := map[string]int{}
+	var duration int64
+	for _, test := range r.tests {
+		statuses[test.Content.Meta[constants.TestStatus]]++
+		if !strings.Contains(test.Content.Meta[constants.TestName], "/") {
+			duration += test.Content.Duration
+		}
+	}
+	fmt.Fprintln(&b, "Datadog CI Visibility summary")
+	fmt.Fprintf(&b, "  %d tests: %d passed, %d failed, %d skipped (%s)\n", len(r.tests),
+		statuses[constants.TestStatusPass], statuses[constants.TestStatusFail], statuses[constants.TestStatusSkip],
+		time.Duration(duration).Round(time.Millisecond))
+
+	if r.slowest > 0 && len(r.tests) > 0 {
+		slowest := make([]citestcycle.Event, len(r.tests))
+		copy(slowest, r.tests)
+		sort.SliceStable(slowest, func(i, j int) bool {
+			return slowest[i].Content.Duration > slowest[j].Content.Duration
+		})
+		if len(slowest) > r.slowest {
+			slowest = slowest[:r.slowest]
+		}
+		fmt.Fprintf(&b, "\nSlowest tests:\n")
+		for _, test := range slowest {
+			fmt.Fprintf(&b, "  %10s  %s\n", time.Duration(test.Content.Duration).Round(time.Millisecond), fullName(test))
+		}
+	}
+
+	var failed []string
+	for _, test := range r.tests {
+		if test.Content.Meta[constants.TestStatus] == constants.TestStatusFail {
+			failed = append(failed, fmt.Sprintf("  %s: %s\n", fullName(test), firstErrorLine(test)))
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(&b, "\nFailed tests:\n%s", strings.Join(failed, ""))
+	}
+
+	if flaky := flakyTests(r.tests); len(flaky) > 0 {
+		fmt.Fprintf(&b, "\nFlaky tests:\n%s", strings.Join(flaky, ""))
+	}
+
+	if r.session != nil {
+		if u := sessionURL(r.site, r.session); u != "" {
+			fmt.Fprintf(&b, "\nTest session: %s\n", u)
+		}
+	}
+
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+func fullName(test citestcycle.Event) string {
+	return fmt.Sprintf("%s.%s", test.Content.Meta[constants.TestSuite], test.Content.Meta[constants.TestName])
+}
+
+func firstErrorLine(test citestcycle.Event) string {
+	message := strings.TrimSpace(test.Content.Meta["error.msg"])
+	if message == "" {
+		return "failed"
+	}
+	return strings.SplitN(message, "\n", 2)[0]
+}
+
+// flakyTests lists the tests that were executed several times with different outcomes,
+// e.g. when retried or run with -count.
+func flakyTests(tests []citestcycle.Event) []string {
+	type attempts struct {
+		total  int
+		failed int
+	}
+	byName := map[string]*attempts{}
+	var names []string
+	for _, test := range tests {
+		name := fullName(test)
+		a, ok := byName[name]
+		if !ok {
+			a = &attempts{}
+			byName[name] = a
+			names = append(names, name)
+		}
+		a.total++
+		if test.Content.Meta[constants.TestStatus] == constants.TestStatusFail {
+			a.failed++
+		}
+	}
+
+	var flaky []string
+	for _, name := range names {
+		if a := byName[name]; a.failed > 0 && a.failed < a.total {
+			flaky = append(flaky, fmt.Sprintf("  %s: %d of %d attempts failed\n", name, a.failed, a.total))
+		}
+	}
+	return flaky
+}
+
+// sessionURL returns the URL of the CI Visibility test runs of the session, identified by its
+// pipeline when running in a CI provider or by its commit otherwise.
+func sessionURL(site string, session *citestcycle.Event) string {
+	meta := session.Content.Meta
+	var query []string
+	if id := meta[constants.CIPipelineID]; id != "" {
+		query = append(query, fmt.Sprintf("@ci.pipeline.id:%q", id))
+	} else if sha := meta[constants.GitCommitSHA]; sha != "" {
+		query = append(query, fmt.Sprintf("@git.commit.sha:%s", sha))
+		if branch := meta[constants.GitBranch]; branch != "" {
+			query = append(query, fmt.Sprintf("@git.branch:%q", branch))
+		}
+	} else {
+		return ""
+	}
+	if service := session.Content.Service; service != "" {
+		query = append(query, fmt.Sprintf("@test.service:%q", service))
+	}
+	return fmt.Sprintf("https://%s/ci/test-runs?query=%s", appHost(site), url.QueryEscape(strings.Join(query, " ")))
+}
+
+// appHost returns the host of the Datadog application for the given site.
+func appHost(site string) string {
+	if site == "" {
+		site = "datadoghq.com"
+	}
+	if strings.Count(site, ".") > 1 {
+		// sites like us3.datadoghq.com already are the application host
+		return site
+	}
+	return "app." + site
+}
@@ -0,0 +1,63 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/citestcycle"
+)
+
+func TestSummaryReporter(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewSummaryReporter(&buf, 2, "datadoghq.eu")
+	reporter.Export([]citestcycle.Event{
+		testEvent("pkg", "TestA", "pass", 1, 3*time.Second, nil),
+		testEvent("pkg", "TestB", "fail", 2, time.Second, map[string]string{"error.msg": "expected 1\ngot 2"}),
+		testEvent("pkg", "TestB", "pass", 3, 2*time.Second, nil),
+		testEvent("pkg", "TestC", "skip", 4, 0, nil),
+		testEvent("pkg", "TestD", "fail", 5, time.Millisecond, nil),
+	})
+	reporter.Export([]citestcycle.Event{{
+		Type: citestcycle.EventTypeTestSession,
+		Content: citestcycle.Content{
+			Service: "my-service",
+			Meta:    map[string]string{"ci.pipeline.id": "42", "git.commit.sha": "abc"},
+		},
+	}})
+	if err := reporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, expected := range []string{
+		"5 tests: 2 passed, 2 failed, 1 skipped (6.001s)",
+		"Slowest tests:\n          3s  pkg.TestA\n          2s  pkg.TestB\n\n",
+		"Failed tests:\n  pkg.TestB: expected 1\n  pkg.TestD: failed\n",
+		"Flaky tests:\n  pkg.TestB: 1 of 2 attempts failed\n",
+		"Test session: https://app.datadoghq.eu/ci/test-runs?query=%40ci.pipeline.id%3A%2242%22+%40test.service%3A%22my-service%22\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("summary does not contain %q:\n%s", expected, out)
+		}
+	}
+}
+
+func TestSummaryAppHost(t *testing.T) {
+	for site, expected := range map[string]string{
+		"":                  "app.datadoghq.com",
+		"datadoghq.eu":      "app.datadoghq.eu",
+		"us3.datadoghq.com": "us3.datadoghq.com",
+		"ddog-gov.com":      "app.ddog-gov.com",
+	} {
+		if host := appHost(site); host != expected {
+			t.Errorf("appHost(%q) = %q, expected %q", site, host, expected)
+		}
+	}
+}
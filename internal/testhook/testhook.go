@@ -0,0 +1,15 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+// Package testhook gives the ddtestingtest package access to the internals of the instrumentation.
+package testhook
+
+// StartSession starts a new test session linking the tests started afterwards. The returned function
+// finishes the session and restores the previous one. It is set by the dd_sdk_go_testing package.
+var StartSession func() (finish func())
+
+// RestoreTracer starts again the tracer started by ddtesting.Run, if it is still running, once a mock
+// tracer stopped it. It is set by the dd_sdk_go_testing package.
+var RestoreTracer func()
@@ -0,0 +1,123 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+// Package testspan holds the helpers creating the test session, module, suite and test spans, shared
+// by ddtesting.Run and the ddtest gotest command.
+package testspan
+
+import (
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/utils"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const (
+	// Kind is the span.kind tag of the test spans.
+	Kind = "test"
+
+	// Framework is the test.framework tag of the test spans.
+	Framework = "golang.org/pkg/testing"
+)
+
+// Options returns the options of a test span of the given type, tagged with the CI tags, followed by opts.
+func Options(spanType string, tags map[string]string, opts ...ddtrace.StartSpanOption) []ddtrace.StartSpanOption {
+	spanOpts := []ddtrace.StartSpanOption{
+		tracer.SpanType(spanType),
+		tracer.Tag(constants.SpanKind, Kind),
+		tracer.Tag(ext.ManualKeep, true),
+		tracer.Tag(constants.TestFramework, Framework),
+		tracer.Tag(constants.Origin, constants.CIAppTestOrigin),
+	}
+	for k, v := range tags {
+		spanOpts = append(spanOpts, tracer.Tag(k, v))
+	}
+	return append(spanOpts, opts...)
+}
+
+// Finish finishes the span with the given status, skipped if empty, and the error message of a
+// failure, if any. The span finishes at end, or now if end is zero.
+func Finish(span ddtrace.Span, status, msg string, end time.Time) {
+	if status == "" {
+		status = constants.TestStatusSkip
+	}
+	span.SetTag(constants.TestStatus, status)
+	if status == constants.TestStatusFail {
+		span.SetTag(ext.Error, true)
+		if msg != "" {
+			span.SetTag(ext.ErrorMsg, msg)
+		}
+	}
+	if end.IsZero() {
+		span.Finish()
+		return
+	}
+	span.Finish(tracer.FinishTime(end))
+}
+
+// MergeStatus aggregates the status of a test into the status of its parent: any failure
+// fails the parent and the parent is only skipped if all its tests were skipped.
+func MergeStatus(current, status string) string {
+	switch {
+	case current == constants.TestStatusFail || status == constants.TestStatusFail:
+		return constants.TestStatusFail
+	case current == constants.TestStatusPass || status == constants.TestStatusPass:
+		return constants.TestStatusPass
+	default:
+		return status
+	}
+}
+
+// FormatID formats a span ID as the value of the test.*_id tags.
+func FormatID(id uint64) string {
+	return strconv.FormatUint(id, 10)
+}
+
+// GitDiff returns the lines changed since the merge-base with the base branch of the pull request
+// tested, as found in the CI tags, or nil.
+func GitDiff(tags map[string]string) utils.GitDiff {
+	base := tags[constants.GitPullRequestBaseBranch]
+	if base == "" {
+		return nil
+	}
+	diff, err := utils.LocalGetGitDiff(base)
+	if err != nil {
+		// Typically the base branch isn't fetched by a shallow clone.
+		log.Printf("dd-sdk-go-testing: cannot compute the changes of the pull request, the modified tests won't be tagged: %v", err)
+		return nil
+	}
+	return diff
+}
+
+// SourceOptions returns the span options locating the source of a test declared in file between
+// the lines start and end, relative to the workspace path of the CI tags, and telling whether it
+// changed in diff: when the lines are unknown, start is 0 and any change of the file counts.
+func SourceOptions(file string, start, end int, tags map[string]string, diff utils.GitDiff) []ddtrace.StartSpanOption {
+	file = utils.ResolveSourcePath(file)
+	var opts []ddtrace.StartSpanOption
+	if diff != nil && diff.Intersects(file, start, end) {
+		opts = append(opts, tracer.Tag(constants.TestIsModified, "true"))
+	}
+	if root := tags[constants.CIWorkspacePath]; root != "" {
+		if rel, err := filepath.Rel(root, file); err == nil && !strings.HasPrefix(rel, "..") {
+			file = filepath.ToSlash(rel)
+		}
+	}
+	opts = append(opts, tracer.Tag(constants.TestSourceFile, file))
+	if start > 0 {
+		opts = append(opts,
+			tracer.Tag(constants.TestSourceStartLine, start),
+			tracer.Tag(constants.TestSourceEndLine, end),
+		)
+	}
+	return opts
+}
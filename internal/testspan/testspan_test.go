@@ -0,0 +1,52 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package testspan
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/utils"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+func TestSourceOptions(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	root, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(root, "internal", "testspan", "testspan_test.go")
+	tags := map[string]string{constants.CIWorkspacePath: root}
+	diff := utils.GitDiff{file: {{Start: 10, End: 12}}}
+
+	for _, tt := range []struct {
+		name       string
+		file       string
+		start, end int
+		modified   interface{}
+	}{
+		{"changed lines", file, 8, 10, "true"},
+		{"other lines", file, 20, 30, nil},
+		{"unknown lines", file, 0, 0, "true"},
+		{"trimpath", "github.com/DataDog/dd-sdk-go-testing/internal/testspan/testspan_test.go", 12, 20, "true"},
+	} {
+		span := tracer.StartSpan("test", SourceOptions(tt.file, tt.start, tt.end, tags, diff)...).(mocktracer.Span)
+		if modified := span.Tag(constants.TestIsModified); modified != tt.modified {
+			t.Errorf("%s: expected %v for %s, got %v", tt.name, tt.modified, constants.TestIsModified, modified)
+		}
+		if source := span.Tag(constants.TestSourceFile); source != "internal/testspan/testspan_test.go" {
+			t.Errorf("%s: unexpected source file %v", tt.name, source)
+		}
+		if start := span.Tag(constants.TestSourceStartLine); (tt.start == 0) != (start == nil) {
+			t.Errorf("%s: unexpected start line %v", tt.name, start)
+		}
+	}
+}
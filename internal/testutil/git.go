@@ -0,0 +1,71 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+// Package testutil holds the helpers shared by the tests of the internal packages.
+package testutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// NewRepository creates a repository with the given number of commits on the feature/reader branch,
+// tracking the upstream remote, and returns its path. The test is skipped without the git binary.
+func NewRepository(t *testing.T, commits int) (string, func()) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "dd-sdk-go-testing-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, _ = filepath.EvalSymlinks(dir)
+	cleanup := func() { os.RemoveAll(dir) }
+
+	Git(t, dir, "init", "-q")
+	Git(t, dir, "checkout", "-q", "-b", "feature/reader")
+	Git(t, dir, "remote", "add", "upstream", "https://github.com/DataDog/upstream.git")
+	Git(t, dir, "config", "branch.feature/reader.remote", "upstream")
+	content := strings.Repeat("the same line, so that the blobs are stored as deltas\n", 200)
+	for i := 0; i < commits; i++ {
+		content += fmt.Sprintf("line %d\n", i)
+		if err := ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte(content), 0644); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		Git(t, dir, "add", "file.txt")
+		Git(t, dir, "commit", "-q", "-m", fmt.Sprintf("Commit %d\n\nWith a body.", i))
+	}
+	return dir, cleanup
+}
+
+// Git runs a git command in dir, as a fixed committer, and returns its output.
+func Git(t *testing.T, dir string, args ...string) string {
+	args = append([]string{"-c", "user.name=Jane Doe", "-c", "user.email=jane@example.com", "-c", "commit.gpgsign=false"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// Chdir changes the working directory to dir and returns a function restoring it.
+func Chdir(t *testing.T, dir string) func() {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return func() { os.Chdir(wd) }
+}
@@ -0,0 +1,189 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAgentHost = "localhost"
+	defaultAgentPort = "8126"
+
+	// evpProxyEndpoint is the endpoint the agent exposes to proxy the Event Platform intakes.
+	evpProxyEndpoint = "/evp_proxy/v2/"
+
+	infoTimeout = 2 * time.Second
+
+	// defaultTracerTimeout is the timeout of the default HTTP client of the tracer.
+	defaultTracerTimeout = 2 * time.Second
+)
+
+// Agent is the agent the tracer sends the payloads to.
+type Agent struct {
+	// URL is the base URL of the agent, e.g. http://localhost:8126.
+	URL string
+	// Transport sends the requests to the agent, e.g. through a unix socket, or
+	// http.DefaultTransport if nil.
+	Transport http.RoundTripper
+	// Timeout bounds the requests of the tracer to the agent.
+	Timeout time.Duration
+
+	infoOnce sync.Once
+	info     *AgentInfo
+	infoErr  error
+}
+
+// NewAgent returns the agent at addr, the host:port the tracer is configured with, reached through
+// transport. Like the tracer, the host and port default to localhost:8126 and are overridden by
+// DD_AGENT_HOST and DD_TRACE_AGENT_PORT.
+func NewAgent(addr string, transport http.RoundTripper) *Agent {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		// no port in addr
+		host = addr
+	}
+	if host == "" {
+		host = defaultAgentHost
+	}
+	if port == "" {
+		port = defaultAgentPort
+	}
+	if v := os.Getenv("DD_AGENT_HOST"); v != "" {
+		host = v
+	}
+	if v := os.Getenv("DD_TRACE_AGENT_PORT"); v != "" {
+		port = v
+	}
+	return &Agent{
+		URL:       fmt.Sprintf("http://%s", net.JoinHostPort(host, port)),
+		Transport: transport,
+		Timeout:   defaultTracerTimeout,
+	}
+}
+
+// ParseAgentURL returns the agent at the URL of DD_TRACE_AGENT_URL, either http://host:port or
+// unix:///path/to/apm.socket. Like with NewAgent, the host and port of an http URL are overridden
+// by DD_AGENT_HOST and DD_TRACE_AGENT_PORT.
+func ParseAgentURL(agentURL string) (*Agent, error) {
+	u, err := url.Parse(agentURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http":
+		return NewAgent(u.Host, nil), nil
+	case "unix":
+		if u.Path == "" {
+			return nil, fmt.Errorf("missing the socket path in %s", agentURL)
+		}
+		return &Agent{
+			URL:       fmt.Sprintf("http://%s", net.JoinHostPort(defaultAgentHost, defaultAgentPort)),
+			Transport: NewUDSTransport(u.Path),
+			Timeout:   defaultTracerTimeout,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported scheme in %s", agentURL)
+}
+
+// AgentFromEnv returns the agent configured by DD_TRACE_AGENT_URL, or else by DD_AGENT_HOST and
+// DD_TRACE_AGENT_PORT.
+func AgentFromEnv() *Agent {
+	if v := os.Getenv("DD_TRACE_AGENT_URL"); v != "" {
+		agent, err := ParseAgentURL(v)
+		if err == nil {
+			return agent
+		}
+		log.Printf("dd-sdk-go-testing: ignoring DD_TRACE_AGENT_URL: %v", err)
+	}
+	return NewAgent("", nil)
+}
+
+// NewUDSTransport returns a transport sending the requests through the unix socket at path.
+func NewUDSTransport(path string) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}
+}
+
+// Info returns the features of the agent. The agent is queried once, the result is cached.
+func (a *Agent) Info() (*AgentInfo, error) {
+	a.infoOnce.Do(func() {
+		a.info, a.infoErr = getAgentInfo(a.client(infoTimeout), a.URL)
+	})
+	return a.info, a.infoErr
+}
+
+// HasEVPProxy reports whether the agent proxies the Event Platform intakes.
+func (a *Agent) HasEVPProxy() bool {
+	info, err := a.Info()
+	return err == nil && info.HasEVPProxy()
+}
+
+// client returns an HTTP client sending the requests to the agent with the given timeout.
+func (a *Agent) client(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: a.Transport, Timeout: timeout}
+}
+
+// AgentInfo is the response of the agent /info endpoint.
+type AgentInfo struct {
+	Version   string   `json:"version"`
+	Endpoints []string `json:"endpoints"`
+}
+
+// getAgentInfo queries the /info endpoint of the agent at agentURL.
+func getAgentInfo(client *http.Client, agentURL string) (*AgentInfo, error) {
+	resp, err := client.Get(strings.TrimSuffix(agentURL, "/") + "/info")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// agents older than 7.28.0 don't expose their features
+		return nil, fmt.Errorf("agent info returned %s", resp.Status)
+	}
+
+	var info AgentInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("cannot decode the agent info: %v", err)
+	}
+	return &info, nil
+}
+
+// HasEVPProxy reports whether the agent proxies the Event Platform intakes.
+func (i *AgentInfo) HasEVPProxy() bool {
+	for _, endpoint := range i.Endpoints {
+		if endpoint == evpProxyEndpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// NewEVPProxyExporter returns an exporter sending the events to the citestcycle intake through
+// the Event Platform proxy of the agent.
+func NewEVPProxyExporter(agent *Agent) *IntakeExporter {
+	return &IntakeExporter{
+		url: strings.TrimSuffix(agent.URL, "/") + evpProxyEndpoint + "api/v2/citestcycle",
+		headers: map[string]string{
+			"X-Datadog-EVP-Subdomain": "citestcycle-intake",
+		},
+		client: agent.client(intakeTimeout),
+	}
+}
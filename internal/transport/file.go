@@ -0,0 +1,93 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/citestcycle"
+)
+
+// maxEventLineSize bounds the size of a single event when reading an output file.
+const maxEventLineSize = 16 * 1024 * 1024
+
+// FileExporter appends the events as newline-delimited JSON to a file. The file is locked
+// while a batch of events is written, so several test binaries can share the same file.
+type FileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+var _ Exporter = (*FileExporter)(nil)
+
+// NewFileExporter returns an exporter appending the events to the file at path, which is
+// created if it doesn't exist.
+func NewFileExporter(path string) (*FileExporter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{file: file}, nil
+}
+
+// Export implements Exporter.
+func (e *FileExporter) Export(events []citestcycle.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := lockFile(e.file); err != nil {
+		return fmt.Errorf("cannot lock %s: %v", e.file.Name(), err)
+	}
+	defer unlockFile(e.file)
+	_, err := e.file.Write(buf.Bytes())
+	return err
+}
+
+// Close implements Exporter.
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
+
+// ReadEventsFile reads the events written by a FileExporter to the file at path.
+func ReadEventsFile(path string) ([]citestcycle.Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []citestcycle.Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxEventLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var event citestcycle.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
@@ -0,0 +1,21 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+// +build !windows,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package transport
+
+import (
+	"os"
+)
+
+// lockFile is a no-op on platforms without advisory locks, the writes still rely on O_APPEND.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
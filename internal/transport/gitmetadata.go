@@ -0,0 +1,186 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// GitMetadataURL returns the base URL of the git metadata API of the given Datadog site.
+func GitMetadataURL(site string) string {
+	if site == "" {
+		site = DefaultSite
+	}
+	return fmt.Sprintf("https://api.%s/api/v2/git/repository", site)
+}
+
+// GitMetadataClient sends the commits of a repository to the git metadata API, so that the backend
+// knows its commit graph.
+type GitMetadataClient struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewGitMetadataClientFromEnv returns the client of the git metadata API, either used directly in
+// agentless mode or through the agent when it proxies the API. It returns nil if neither is possible.
+func NewGitMetadataClientFromEnv(agent *Agent) *GitMetadataClient {
+	if agentless, _ := strconv.ParseBool(os.Getenv("DD_CIVISIBILITY_AGENTLESS_ENABLED")); agentless {
+		if apiKey := os.Getenv("DD_API_KEY"); apiKey != "" {
+			return NewGitMetadataClient(GitMetadataURL(os.Getenv("DD_SITE")), map[string]string{
+				"dd-api-key": apiKey,
+			})
+		}
+	}
+
+	if agent.HasEVPProxy() {
+		client := NewGitMetadataClient(strings.TrimSuffix(agent.URL, "/")+evpProxyEndpoint+"api/v2/git/repository", map[string]string{
+			"X-Datadog-EVP-Subdomain": "api",
+		})
+		client.client = agent.client(intakeTimeout)
+		return client
+	}
+	return nil
+}
+
+// NewGitMetadataClient returns a client of the git metadata API at url, sending the given headers.
+func NewGitMetadataClient(url string, headers map[string]string) *GitMetadataClient {
+	return &GitMetadataClient{
+		url:     strings.TrimSuffix(url, "/"),
+		headers: headers,
+		client:  &http.Client{Timeout: intakeTimeout},
+	}
+}
+
+type gitCommit struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type gitRepositoryMeta struct {
+	RepositoryURL string `json:"repository_url"`
+}
+
+type searchCommitsRequest struct {
+	Meta gitRepositoryMeta `json:"meta"`
+	Data []gitCommit       `json:"data"`
+}
+
+type searchCommitsResponse struct {
+	Data []gitCommit `json:"data"`
+}
+
+type pushedSha struct {
+	Data gitCommit         `json:"data"`
+	Meta gitRepositoryMeta `json:"meta"`
+}
+
+// SearchCommits returns the commits the backend already knows among the given ones.
+func (c *GitMetadataClient) SearchCommits(ctx context.Context, repositoryURL string, commits []string) ([]string, error) {
+	body := searchCommitsRequest{Meta: gitRepositoryMeta{RepositoryURL: repositoryURL}}
+	for _, sha := range commits {
+		body.Data = append(body.Data, gitCommit{ID: sha, Type: "commit"})
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.post(ctx, "/search_commits", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result searchCommitsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("cannot decode the known commits: %v", err)
+	}
+	known := make([]string, 0, len(result.Data))
+	for _, commit := range result.Data {
+		if commit.Type == "commit" {
+			known = append(known, commit.ID)
+		}
+	}
+	return known, nil
+}
+
+// UploadPackfile uploads the pack file at path, holding the objects of the commits pushed up to sha.
+func (c *GitMetadataClient) UploadPackfile(ctx context.Context, repositoryURL, sha, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="pushedSha"`)
+	header.Set("Content-Type", "application/json")
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(part).Encode(pushedSha{
+		Data: gitCommit{ID: sha, Type: "commit"},
+		Meta: gitRepositoryMeta{RepositoryURL: repositoryURL},
+	})
+	if err != nil {
+		return err
+	}
+	part, err = w.CreateFormFile("packfile", filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	resp, err := c.post(ctx, "/packfile", w.FormDataContentType(), &buf)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// post sends body to the endpoint of the API and returns the response if it is successful.
+func (c *GitMetadataClient) post(ctx context.Context, endpoint, contentType string, body io.Reader) (*http.Response, error) {
+	url := c.url + endpoint
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create http request: %v", err)
+	}
+	req = req.WithContext(ctx)
+	for header, value := range c.headers {
+		req.Header.Set(header, value)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(url, resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
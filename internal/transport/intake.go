@@ -0,0 +1,125 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/citestcycle"
+)
+
+const (
+	// DefaultSite is the Datadog site used when DD_SITE is not set.
+	DefaultSite = "datadoghq.com"
+
+	intakeTimeout = 15 * time.Second
+)
+
+// AgentlessURL returns the URL of the citestcycle intake of the given Datadog site.
+func AgentlessURL(site string) string {
+	if site == "" {
+		site = DefaultSite
+	}
+	return fmt.Sprintf("https://citestcycle-intake.%s/api/v2/citestcycle", site)
+}
+
+// NewIntakeExporterFromEnv returns the exporter sending the events to the citestcycle intake,
+// either directly in agentless mode or through the agent when it proxies the intake. It returns
+// nil if the agent only supports the trace API.
+func NewIntakeExporterFromEnv(agent *Agent) Exporter {
+	if agentless, _ := strconv.ParseBool(os.Getenv("DD_CIVISIBILITY_AGENTLESS_ENABLED")); agentless {
+		apiKey := os.Getenv("DD_API_KEY")
+		if apiKey != "" {
+			url := os.Getenv("DD_CIVISIBILITY_AGENTLESS_URL")
+			if url == "" {
+				url = AgentlessURL(os.Getenv("DD_SITE"))
+			}
+			return NewAgentlessExporter(url, apiKey)
+		}
+		log.Print("dd-sdk-go-testing: DD_CIVISIBILITY_AGENTLESS_ENABLED requires DD_API_KEY, sending the test events to the agent instead")
+	}
+
+	if agent.HasEVPProxy() {
+		return NewEVPProxyExporter(agent)
+	}
+	return nil
+}
+
+// IntakeExporter sends the events encoded as citestcycle payloads to an HTTP endpoint.
+type IntakeExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+var _ Exporter = (*IntakeExporter)(nil)
+
+// NewAgentlessExporter returns an exporter sending the events directly to the citestcycle
+// intake at url, authenticated with the given API key.
+func NewAgentlessExporter(url, apiKey string) *IntakeExporter {
+	return &IntakeExporter{
+		url: url,
+		headers: map[string]string{
+			"dd-api-key": apiKey,
+		},
+		client: &http.Client{Timeout: intakeTimeout},
+	}
+}
+
+// Export implements Exporter.
+func (e *IntakeExporter) Export(events []citestcycle.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	body, err := gzipPayload(citestcycle.NewPayload(events).MarshalMsg(nil))
+	if err != nil {
+		return err
+	}
+	return e.post(body)
+}
+
+// Close implements Exporter.
+func (e *IntakeExporter) Close() error {
+	return nil
+}
+
+func (e *IntakeExporter) post(body []byte) error {
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create http request: %v", err)
+	}
+	for header, value := range e.headers {
+		req.Header.Set(header, value)
+	}
+	req.Header.Set("Content-Type", "application/msgpack")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(e.url, resp)
+}
+
+func gzipPayload(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
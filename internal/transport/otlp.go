@@ -0,0 +1,380 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/citestcycle"
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+)
+
+// otlpTracesPath is the path of the OTLP/HTTP traces endpoint, used when the endpoint has no path.
+const otlpTracesPath = "/v1/traces"
+
+// Define the OTLP span kinds and status codes.
+const (
+	otlpSpanKindInternal = 1
+
+	otlpStatusUnset = 0
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+// otlpAttributeNames maps the tags to their OpenTelemetry semantic-convention attribute names.
+// The tags without a semantic-convention equivalent keep their name.
+var otlpAttributeNames = map[string]string{
+	constants.CIPipelineName:   "cicd.pipeline.name",
+	constants.CIPipelineID:     "cicd.pipeline.run.id",
+	constants.CIPipelineURL:    "cicd.pipeline.run.url.full",
+	constants.CIJobName:        "cicd.pipeline.task.name",
+	constants.CIJobURL:         "cicd.pipeline.task.run.url.full",
+	constants.GitRepositoryURL: "vcs.repository.url.full",
+	constants.GitCommitSHA:     "vcs.ref.head.revision",
+	constants.GitBranch:        "vcs.ref.head.name",
+	constants.OSPlatform:       "os.type",
+	constants.OSVersion:        "os.version",
+	constants.OSArchitecture:   "host.arch",
+	constants.RuntimeName:      "process.runtime.name",
+	constants.RuntimeVersion:   "process.runtime.version",
+	constants.TestName:         "test.case.name",
+	constants.TestSuite:        "test.suite.name",
+}
+
+// otlpResourceAttributes are the attributes describing the process running the tests, sent once
+// as resource attributes instead of on every span.
+var otlpResourceAttributes = map[string]bool{
+	"os.type":                 true,
+	"os.version":              true,
+	"host.arch":               true,
+	"process.runtime.name":    true,
+	"process.runtime.version": true,
+}
+
+// otlpArchitectures maps the Go architectures to their semantic-convention values when they differ.
+var otlpArchitectures = map[string]string{
+	"386": "x86",
+	"arm": "arm32",
+}
+
+// OTLPExporter sends the events as OTLP spans to an OpenTelemetry collector, using the JSON
+// encoding of OTLP/HTTP.
+type OTLPExporter struct {
+	url     string
+	headers map[string]string
+	gzip    bool
+	client  *http.Client
+}
+
+var _ Exporter = (*OTLPExporter)(nil)
+
+// NewOTLPExporter returns an exporter sending the events to the OTLP/HTTP traces endpoint. The
+// /v1/traces path is added to endpoint when it has none.
+func NewOTLPExporter(endpoint string, headers map[string]string, gzip bool) *OTLPExporter {
+	if u, err := url.Parse(endpoint); err == nil && (u.Path == "" || u.Path == "/") {
+		u.Path = otlpTracesPath
+		endpoint = u.String()
+	}
+	return &OTLPExporter{
+		url:     endpoint,
+		headers: headers,
+		gzip:    gzip,
+		client:  &http.Client{Timeout: intakeTimeout},
+	}
+}
+
+// NewOTLPExporterFromEnv returns an exporter sending the events to the OTLP/HTTP traces endpoint,
+// configured with the OTEL_EXPORTER_OTLP_HEADERS and OTEL_EXPORTER_OTLP_COMPRESSION environment
+// variables or their traces-specific variants.
+func NewOTLPExporterFromEnv(endpoint string) *OTLPExporter {
+	headers := ParseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	for k, v := range ParseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS")) {
+		headers[k] = v
+	}
+	compression := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_COMPRESSION")
+	if compression == "" {
+		compression = os.Getenv("OTEL_EXPORTER_OTLP_COMPRESSION")
+	}
+	return NewOTLPExporter(endpoint, headers, compression == "gzip")
+}
+
+// ParseOTLPHeaders parses headers in the format of OTEL_EXPORTER_OTLP_HEADERS: a comma-separated
+// list of key=value pairs with URL-encoded values.
+func ParseOTLPHeaders(s string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(kv[0])
+		value, err := url.QueryUnescape(strings.TrimSpace(kv[1]))
+		if key == "" || err != nil {
+			continue
+		}
+		headers[key] = value
+	}
+	return headers
+}
+
+// Export implements Exporter.
+func (e *OTLPExporter) Export(events []citestcycle.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(newOTLPRequest(events))
+	if err != nil {
+		return fmt.Errorf("cannot encode the OTLP request: %v", err)
+	}
+	if e.gzip {
+		if body, err = gzipPayload(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create http request: %v", err)
+	}
+	for header, value := range e.headers {
+		req.Header.Set(header, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(e.url, resp)
+}
+
+// Close implements Exporter.
+func (e *OTLPExporter) Close() error {
+	return nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func otlpDouble(key string, value float64) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{DoubleValue: &value}}
+}
+
+// newOTLPRequest converts the events into an OTLP export request. The session, module, suite and
+// test spans are linked into a single trace identified by the test session.
+func newOTLPRequest(events []citestcycle.Event) *otlpRequest {
+	// A test and the spans it created share a trace, which is moved to the session trace.
+	sessions := map[uint64]uint64{}
+	for _, event := range events {
+		if event.Type == citestcycle.EventTypeTest && event.Content.TestSessionID != 0 {
+			sessions[event.Content.TraceID] = event.Content.TestSessionID
+		}
+	}
+
+	var services []string
+	resources := map[string]*otlpResourceSpans{}
+	for _, event := range events {
+		span, resourceAttrs := newOTLPSpan(event, sessions)
+		rs, ok := resources[event.Content.Service]
+		if !ok {
+			rs = &otlpResourceSpans{
+				Resource: otlpResource{Attributes: append([]otlpKeyValue{
+					otlpString("service.name", event.Content.Service),
+					otlpString("telemetry.sdk.name", "dd-sdk-go-testing"),
+					otlpString("telemetry.sdk.language", "go"),
+				}, resourceAttrs...)},
+				ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/DataDog/dd-sdk-go-testing"}}},
+			}
+			resources[event.Content.Service] = rs
+			services = append(services, event.Content.Service)
+		}
+		rs.ScopeSpans[0].Spans = append(rs.ScopeSpans[0].Spans, span)
+	}
+
+	req := &otlpRequest{}
+	for _, service := range services {
+		req.ResourceSpans = append(req.ResourceSpans, *resources[service])
+	}
+	return req
+}
+
+// newOTLPSpan converts an event into an OTLP span, returning the resource attributes found in its
+// tags separately.
+func newOTLPSpan(event citestcycle.Event, sessions map[uint64]uint64) (otlpSpan, []otlpKeyValue) {
+	c := event.Content
+	span := otlpSpan{
+		Name:              c.Resource,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: fmt.Sprint(c.Start),
+		EndTimeUnixNano:   fmt.Sprint(c.Start + c.Duration),
+	}
+	if span.Name == "" {
+		span.Name = c.Name
+	}
+
+	traceID, spanID, parentID := c.TraceID, c.SpanID, c.ParentID
+	switch event.Type {
+	case citestcycle.EventTypeTestSession:
+		traceID, spanID, parentID = c.TestSessionID, c.TestSessionID, 0
+	case citestcycle.EventTypeTestModule:
+		traceID, spanID, parentID = c.TestSessionID, c.TestModuleID, c.TestSessionID
+	case citestcycle.EventTypeTestSuite:
+		traceID, spanID, parentID = c.TestSessionID, c.TestSuiteID, c.TestModuleID
+	case citestcycle.EventTypeTest:
+		if parentID == 0 {
+			parentID = c.TestSuiteID
+		}
+	}
+	if session, ok := sessions[traceID]; ok {
+		traceID = session
+	}
+	span.TraceID = fmt.Sprintf("%032x", traceID)
+	span.SpanID = fmt.Sprintf("%016x", spanID)
+	if parentID != 0 {
+		span.ParentSpanID = fmt.Sprintf("%016x", parentID)
+	}
+
+	var resourceAttrs []otlpKeyValue
+	keys := make([]string, 0, len(c.Meta))
+	for k := range c.Meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if strings.HasPrefix(k, "_dd.") || strings.HasPrefix(k, "error.") {
+			continue
+		}
+		name, value := k, c.Meta[k]
+		if n, ok := otlpAttributeNames[k]; ok {
+			name = n
+		}
+		if k == constants.OSArchitecture {
+			if arch, ok := otlpArchitectures[value]; ok {
+				value = arch
+			}
+		}
+		if otlpResourceAttributes[name] {
+			resourceAttrs = append(resourceAttrs, otlpString(name, value))
+			continue
+		}
+		span.Attributes = append(span.Attributes, otlpString(name, value))
+	}
+	if branch, tag := c.Meta[constants.GitBranch], c.Meta[constants.GitTag]; branch != "" || tag != "" {
+		refType := "branch"
+		if branch == "" {
+			refType = "tag"
+			span.Attributes = append(span.Attributes, otlpString("vcs.ref.head.name", tag))
+		}
+		span.Attributes = append(span.Attributes, otlpString("vcs.ref.head.type", refType))
+	}
+	if event.Type == citestcycle.EventTypeTest {
+		if status := c.Meta[constants.TestStatus]; status == constants.TestStatusPass || status == constants.TestStatusFail {
+			span.Attributes = append(span.Attributes, otlpString("test.case.result.status", status))
+		}
+	}
+
+	metrics := make([]string, 0, len(c.Metrics))
+	for k := range c.Metrics {
+		if !strings.HasPrefix(k, "_") {
+			metrics = append(metrics, k)
+		}
+	}
+	sort.Strings(metrics)
+	for _, k := range metrics {
+		span.Attributes = append(span.Attributes, otlpDouble(k, c.Metrics[k]))
+	}
+
+	switch {
+	case c.Error != 0:
+		span.Status = otlpStatus{Code: otlpStatusError, Message: c.Meta["error.msg"]}
+		var attrs []otlpKeyValue
+		for _, kv := range [][2]string{
+			{"exception.type", c.Meta["error.type"]},
+			{"exception.message", c.Meta["error.msg"]},
+			{"exception.stacktrace", c.Meta["error.stack"]},
+		} {
+			if kv[1] != "" {
+				attrs = append(attrs, otlpString(kv[0], kv[1]))
+			}
+		}
+		if len(attrs) > 0 {
+			span.Events = []otlpEvent{{TimeUnixNano: span.EndTimeUnixNano, Name: "exception", Attributes: attrs}}
+		}
+	case c.Meta[constants.TestStatus] == constants.TestStatusPass:
+		span.Status = otlpStatus{Code: otlpStatusOK}
+	default:
+		span.Status = otlpStatus{Code: otlpStatusUnset}
+	}
+	return span, resourceAttrs
+}
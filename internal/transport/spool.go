@@ -0,0 +1,408 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/citestcycle"
+)
+
+const (
+	// defaultSpoolMaxSize bounds the size of the payloads kept on disk by a spool.
+	defaultSpoolMaxSize = 64 * 1024 * 1024
+
+	// spoolDrainTimeout bounds the time spent delivering the pending payloads when closing.
+	spoolDrainTimeout = 15 * time.Second
+)
+
+// spoolMinBackoff and spoolMaxBackoff bound the time between two delivery attempts.
+var (
+	spoolMinBackoff = 500 * time.Millisecond
+	spoolMaxBackoff = 30 * time.Second
+)
+
+// permanentError is a delivery error that retrying won't fix, e.g. a rejected API key.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+// serverError is a delivery error reported by a destination that is temporarily unable to accept
+// the payload.
+type serverError struct {
+	err error
+}
+
+func (e *serverError) Error() string { return e.err.Error() }
+
+// checkResponse returns an error for the unsuccessful responses of url. Client errors are
+// permanent, except for timeouts and rate limiting.
+func checkResponse(url string, resp *http.Response) error {
+	if resp.StatusCode < 400 {
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(resp.Body)
+	err := fmt.Errorf("%s returned %s: %s", url, resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return &serverError{err}
+}
+
+// SpoolConfigFromEnv returns the directory and the maximum size of the spools, configured with
+// DD_CIVISIBILITY_SPOOL_DIR and DD_CIVISIBILITY_SPOOL_MAX_SIZE. A maximum size of 0 disables them.
+func SpoolConfigFromEnv() (dir string, maxSize int64) {
+	dir = os.Getenv("DD_CIVISIBILITY_SPOOL_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	maxSize = defaultSpoolMaxSize
+	if v, err := strconv.ParseInt(os.Getenv("DD_CIVISIBILITY_SPOOL_MAX_SIZE"), 10, 64); err == nil && v >= 0 {
+		maxSize = v
+	}
+	return dir, maxSize
+}
+
+// newSpoolFromEnv returns a spool named after name delivering the payloads with deliver, or nil if
+// spooling is disabled.
+func newSpoolFromEnv(name string, deliver func([]byte) error) *Spool {
+	dir, maxSize := SpoolConfigFromEnv()
+	if maxSize == 0 {
+		return nil
+	}
+	return NewSpool(filepath.Join(dir, fmt.Sprintf("dd-civisibility-%s-%d", name, os.Getpid())), maxSize, deliver)
+}
+
+// Spool delivers payloads, keeping the ones that can't be delivered right away in a bounded directory
+// from which they are retried in order with exponential backoff and jitter. Network errors are only
+// retried once the destination has been reached, so that a missing agent doesn't delay the tests.
+type Spool struct {
+	dir     string
+	maxSize int64
+	deliver func([]byte) error
+
+	mu       sync.Mutex
+	pending  []spoolEntry
+	size     int64
+	seq      int
+	lost     int
+	lastErr  error
+	attempts int
+	reached  bool
+	running  bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	warned   bool
+
+	// sendMu ensures the pending payloads are delivered one at a time, in order.
+	sendMu sync.Mutex
+}
+
+type spoolEntry struct {
+	path string
+	size int64
+}
+
+// NewSpool returns a spool keeping up to maxSize bytes of payloads in dir, which is only created
+// when a payload has to be retried.
+func NewSpool(dir string, maxSize int64, deliver func([]byte) error) *Spool {
+	return &Spool{
+		dir:     dir,
+		maxSize: maxSize,
+		deliver: deliver,
+		stop:    make(chan struct{}),
+	}
+}
+
+// Send delivers the payload or keeps it to be retried later on. It returns an error if the
+// payload is lost, because it was rejected or the spool is full.
+func (s *Spool) Send(p []byte) error {
+	s.mu.Lock()
+	queued := len(s.pending) > 0
+	s.mu.Unlock()
+	if !queued {
+		return s.Record(p, s.deliver(p))
+	}
+	return s.enqueue(p)
+}
+
+// Record records the outcome of a delivery of the payload attempted by the caller. If it failed
+// with err, the payload is kept to be retried later on like with Send. It returns an error if the
+// payload is lost.
+func (s *Spool) Record(p []byte, err error) error {
+	s.mu.Lock()
+	if err == nil {
+		s.reached = true
+		s.mu.Unlock()
+		return nil
+	}
+	_, permanent := err.(*permanentError)
+	_, unavailable := err.(*serverError)
+	if permanent || (!s.reached && !unavailable) {
+		s.loseLocked(err)
+		s.mu.Unlock()
+		return err
+	}
+	s.mu.Unlock()
+	s.warn(err)
+	return s.enqueue(p)
+}
+
+// loseLocked records a lost payload. s.mu must be held.
+func (s *Spool) loseLocked(err error) {
+	s.lost++
+	s.lastErr = err
+}
+
+func (s *Spool) warn(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.warned {
+		s.warned = true
+		log.Printf("dd-sdk-go-testing: cannot deliver a payload, it will be retried: %v", err)
+	}
+}
+
+func (s *Spool) enqueue(p []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	size := int64(len(p))
+	if s.size+size > s.maxSize {
+		err := fmt.Errorf("the spool is full (%d bytes), dropping a payload of %d bytes", s.maxSize, size)
+		s.loseLocked(err)
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		s.loseLocked(err)
+		return err
+	}
+	s.seq++
+	path := filepath.Join(s.dir, fmt.Sprintf("%08d.payload", s.seq))
+	if err := ioutil.WriteFile(path, p, 0600); err != nil {
+		s.loseLocked(err)
+		return err
+	}
+	s.pending = append(s.pending, spoolEntry{path: path, size: size})
+	s.size += size
+	if !s.running {
+		s.running = true
+		go s.worker()
+	}
+	return nil
+}
+
+// worker retries the pending payloads until they are all delivered or the spool is closed.
+func (s *Spool) worker() {
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.running = false
+			s.mu.Unlock()
+			return
+		}
+		wait := s.backoff()
+		s.mu.Unlock()
+
+		select {
+		case <-time.After(wait):
+			s.retry()
+		case <-s.stop:
+			s.mu.Lock()
+			s.running = false
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// backoff returns the time to wait before the next attempt: it doubles after each failed attempt,
+// with a random jitter of up to half of it. s.mu must be held.
+func (s *Spool) backoff() time.Duration {
+	d := spoolMinBackoff
+	for i := 0; i < s.attempts && d < spoolMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > spoolMaxBackoff {
+		d = spoolMaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retry tries to deliver the oldest pending payload and reports whether it left the spool.
+func (s *Spool) retry() bool {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	s.mu.Lock()
+	if len(s.pending) == 0 {
+		s.mu.Unlock()
+		return true
+	}
+	entry := s.pending[0]
+	s.mu.Unlock()
+
+	p, err := ioutil.ReadFile(entry.path)
+	if err == nil {
+		err = s.deliver(p)
+		if err != nil {
+			if _, ok := err.(*permanentError); !ok {
+				s.mu.Lock()
+				s.attempts++
+				s.lastErr = err
+				s.mu.Unlock()
+				return false
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.loseLocked(err)
+	} else {
+		s.reached = true
+	}
+	s.pending = s.pending[1:]
+	s.size -= entry.size
+	s.attempts = 0
+	os.Remove(entry.path)
+	return true
+}
+
+// Drain retries the pending payloads until they are all delivered or the timeout expires, and
+// returns the number of payloads that were not delivered.
+func (s *Spool) Drain(timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for {
+		s.mu.Lock()
+		empty := len(s.pending) == 0
+		s.mu.Unlock()
+		if empty {
+			break
+		}
+		if s.retry() {
+			continue
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		s.mu.Lock()
+		wait := s.backoff()
+		s.mu.Unlock()
+		if wait > remaining {
+			wait = remaining
+		}
+		time.Sleep(wait)
+	}
+	return s.Undelivered()
+}
+
+// Undelivered returns the number of payloads that were lost or are still pending.
+func (s *Spool) Undelivered() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lost + len(s.pending)
+}
+
+// Err returns the last error preventing the delivery of a payload, if any.
+func (s *Spool) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastErr
+}
+
+// Close drains the spool, then removes it and returns the number of payloads that were not delivered.
+func (s *Spool) Close(timeout time.Duration) int {
+	n := s.Drain(timeout)
+	s.stopOnce.Do(func() { close(s.stop) })
+
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.pending {
+		os.Remove(entry.path)
+	}
+	s.pending = nil
+	s.size = 0
+	os.Remove(s.dir)
+	return n
+}
+
+// SpoolingExporter retries the exports that failed from a spool.
+type SpoolingExporter struct {
+	exporter Exporter
+	spool    *Spool
+}
+
+var _ Exporter = (*SpoolingExporter)(nil)
+
+// NewSpoolingExporterFromEnv returns exporter wrapped into a SpoolingExporter named after name, or
+// exporter itself if spooling is disabled.
+func NewSpoolingExporterFromEnv(name string, exporter Exporter) Exporter {
+	e := &SpoolingExporter{exporter: exporter}
+	e.spool = newSpoolFromEnv(name, e.deliver)
+	if e.spool == nil {
+		return exporter
+	}
+	return e
+}
+
+func (e *SpoolingExporter) deliver(p []byte) error {
+	var events []citestcycle.Event
+	if err := json.Unmarshal(p, &events); err != nil {
+		return &permanentError{err}
+	}
+	return e.exporter.Export(events)
+}
+
+// Export implements Exporter.
+func (e *SpoolingExporter) Export(events []citestcycle.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	p, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return e.spool.Send(p)
+}
+
+// Drain implements drainer.
+func (e *SpoolingExporter) Drain(timeout time.Duration) int {
+	return e.spool.Drain(timeout)
+}
+
+// Close implements Exporter.
+func (e *SpoolingExporter) Close() error {
+	n := e.spool.Close(spoolDrainTimeout)
+	err := e.exporter.Close()
+	if n > 0 && err == nil {
+		err = undeliveredError(n, "payloads", e.spool)
+	}
+	return err
+}
+
+func undeliveredError(n int, what string, s *Spool) error {
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("%d %s could not be delivered: %v", n, what, err)
+	}
+	return fmt.Errorf("%d %s could not be delivered", n, what)
+}
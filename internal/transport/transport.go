@@ -0,0 +1,263 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package transport
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/citestcycle"
+)
+
+// Exporter receives the CI Visibility events of every payload sent by the tracer.
+type Exporter interface {
+	// Export sends or stores the given events.
+	Export(events []citestcycle.Event) error
+	// Close flushes any buffered event and releases the exporter resources.
+	Close() error
+}
+
+// drainQuietPeriod is the time without payload sent by the tracer after which the payloads are
+// considered to have all reached the spools.
+const drainQuietPeriod = 100 * time.Millisecond
+
+// drainer is implemented by the exporters retrying the failed exports.
+type drainer interface {
+	// Drain retries the pending exports until they all succeed or the timeout expires, and
+	// returns the number of payloads that were not delivered.
+	Drain(timeout time.Duration) int
+}
+
+// RoundTripper is an http.RoundTripper to be used by the tracer. It decodes the trace payloads
+// into CI Visibility events and hands them to the exporters.
+type RoundTripper struct {
+	forward   http.RoundTripper
+	exporters []Exporter
+
+	// spool retries the trace payloads that couldn't be forwarded.
+	spool    *Spool
+	inflight int32
+
+	mu        sync.Mutex
+	replayReq *http.Request
+	last      time.Time
+}
+
+var _ http.RoundTripper = (*RoundTripper)(nil)
+
+// NewRoundTripper returns a RoundTripper handing the events to the given exporters. When forward
+// is not nil the original requests are also sent through it, otherwise the tracer requests are
+// answered locally.
+func NewRoundTripper(forward http.RoundTripper, exporters ...Exporter) *RoundTripper {
+	return &RoundTripper{
+		forward:   forward,
+		exporters: exporters,
+	}
+}
+
+// NewForwardingRoundTripper returns a RoundTripper handing the events to the given exporters and
+// sending the original requests to the agent through forward, e.g. the transport of the client the
+// tracer was configured with, or a transport of its own if nil.
+func NewForwardingRoundTripper(forward http.RoundTripper, exporters ...Exporter) *RoundTripper {
+	if forward == nil {
+		forward = newForwardTransport()
+	}
+	rt := NewRoundTripper(forward, exporters...)
+	rt.spool = newSpoolFromEnv("traces", rt.replay)
+	return rt
+}
+
+// newForwardTransport returns the transport sending the requests to the agent over TCP.
+func newForwardTransport() *http.Transport {
+	// We don't use http.DefaultTransport, as it might be augmented with tracing and we don't
+	// want these calls to be recorded.
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// DisableRetries stops retrying the trace payloads that couldn't be forwarded. It must be called
+// before the round tripper is used.
+func (rt *RoundTripper) DisableRetries() {
+	rt.spool = nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	isTraces := req.Body != nil && strings.HasSuffix(req.URL.Path, "/traces")
+	if isTraces && (len(rt.exporters) > 0 || rt.spool != nil) {
+		atomic.AddInt32(&rt.inflight, 1)
+		defer rt.done()
+
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if len(rt.exporters) > 0 {
+			rt.export(body)
+		}
+		if rt.forward != nil && rt.spool != nil {
+			return rt.forwardOrKeep(req, body)
+		}
+	}
+
+	if rt.forward != nil {
+		return rt.forward.RoundTrip(req)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return localResponse(req), nil
+}
+
+// forwardOrKeep forwards the trace payload and returns the response of the agent, so that the
+// tracer gets its sampling rates. When the agent can't be reached or is unavailable, the payload is
+// kept in the spool to be retried, and the request is answered locally.
+func (rt *RoundTripper) forwardOrKeep(req *http.Request, body []byte) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.replayReq = req
+	rt.mu.Unlock()
+
+	resp, err := rt.forward.RoundTrip(req)
+	if err == nil {
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			rt.spool.Record(body, nil)
+			return resp, nil
+		}
+		err = checkResponse(req.URL.String(), resp)
+		resp.Body.Close()
+	}
+	// Lost payloads are reported when closing.
+	if rt.spool.Record(body, err) != nil {
+		return nil, err
+	}
+	return localResponse(req), nil
+}
+
+// localResponse returns the successful response of the agent to a trace payload.
+func localResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}
+}
+
+func (rt *RoundTripper) done() {
+	rt.mu.Lock()
+	rt.last = time.Now()
+	rt.mu.Unlock()
+	atomic.AddInt32(&rt.inflight, -1)
+}
+
+// replay forwards a spooled trace payload like the last request of the tracer.
+func (rt *RoundTripper) replay(body []byte) error {
+	rt.mu.Lock()
+	orig := rt.replayReq
+	rt.mu.Unlock()
+
+	req, err := http.NewRequest(orig.Method, orig.URL.String(), bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err}
+	}
+	for k, v := range orig.Header {
+		req.Header[k] = v
+	}
+	// The trace count of the last request doesn't apply to this payload.
+	req.Header.Del("X-Datadog-Trace-Count")
+	resp, err := rt.forward.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(req.URL.String(), resp)
+}
+
+func (rt *RoundTripper) export(body []byte) {
+	spans, err := citestcycle.DecodeTraces(body)
+	if err != nil {
+		log.Printf("dd-sdk-go-testing: cannot decode the tracer payload: %v", err)
+		return
+	}
+	if len(spans) == 0 {
+		return
+	}
+	events := citestcycle.NewEvents(spans)
+	for _, exporter := range rt.exporters {
+		if err := exporter.Export(events); err != nil {
+			log.Printf("dd-sdk-go-testing: cannot export %d events: %v", len(events), err)
+		}
+	}
+}
+
+// Drain waits for the payloads being sent by the tracer, then retries the payloads that couldn't
+// be delivered until they all are or the timeout expires. It returns the number of payloads that
+// were not delivered.
+func (rt *RoundTripper) Drain(timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		rt.mu.Lock()
+		quiet := time.Since(rt.last) >= drainQuietPeriod
+		rt.mu.Unlock()
+		if quiet && atomic.LoadInt32(&rt.inflight) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	undelivered := 0
+	if rt.spool != nil {
+		undelivered += rt.spool.Drain(time.Until(deadline))
+	}
+	for _, exporter := range rt.exporters {
+		if d, ok := exporter.(drainer); ok {
+			undelivered += d.Drain(time.Until(deadline))
+		}
+	}
+	return undelivered
+}
+
+// Close delivers the pending payloads and closes all the exporters. It must be called once the
+// tracer has been stopped. The payloads that could not be delivered are reported on stderr.
+func (rt *RoundTripper) Close() error {
+	var firstErr error
+	if rt.spool != nil {
+		if n := rt.spool.Close(spoolDrainTimeout); n > 0 {
+			firstErr = undeliveredError(n, "trace payloads", rt.spool)
+		}
+	}
+	for _, exporter := range rt.exporters {
+		if err := exporter.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		log.Printf("dd-sdk-go-testing: %v", firstErr)
+	}
+	return firstErr
+}
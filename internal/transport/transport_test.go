@@ -0,0 +1,580 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/citestcycle"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// tracePayload returns a tracer payload with a single trace containing a single test span.
+func tracePayload() []byte {
+	b := msgp.AppendArrayHeader(nil, 1)
+	b = msgp.AppendArrayHeader(b, 1)
+	b = msgp.AppendMapHeader(b, 5)
+	b = msgp.AppendString(b, "name")
+	b = msgp.AppendString(b, "test")
+	b = msgp.AppendString(b, "type")
+	b = msgp.AppendString(b, "test")
+	b = msgp.AppendString(b, "span_id")
+	b = msgp.AppendUint64(b, 42)
+	b = msgp.AppendString(b, "trace_id")
+	b = msgp.AppendUint64(b, 42)
+	b = msgp.AppendString(b, "meta")
+	b = msgp.AppendMapStrStr(b, map[string]string{"test.status": "pass"})
+	return b
+}
+
+// intakeStandIn records the decoded bodies received by a fake citestcycle intake.
+func intakeStandIn(t *testing.T, bodies chan<- map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("dd-api-key") != "secret" || r.Header.Get("Content-Encoding") != "gzip" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, _ := ioutil.ReadAll(zr)
+		value, _, err := msgp.ReadIntfBytes(data)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		bodies <- value.(map[string]interface{})
+		w.WriteHeader(http.StatusAccepted)
+	}))
+}
+
+func TestAgentlessRoundTripper(t *testing.T) {
+	bodies := make(chan map[string]interface{}, 1)
+	srv := intakeStandIn(t, bodies)
+	defer srv.Close()
+
+	rt := NewRoundTripper(nil, NewAgentlessExporter(srv.URL+"/api/v2/citestcycle", "secret"))
+	req, _ := http.NewRequest("POST", "http://localhost:8126/v0.4/traces", bytes.NewReader(tracePayload()))
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.StatusCode)
+	}
+	if err := rt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	body := <-bodies
+	events := body["events"].([]interface{})
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	event := events[0].(map[string]interface{})
+	if event["type"] != "test" {
+		t.Fatalf("unexpected event: %v", event)
+	}
+	if event["content"].(map[string]interface{})["meta"].(map[string]interface{})["test.status"] != "pass" {
+		t.Fatalf("unexpected event: %v", event)
+	}
+}
+
+func TestAgentlessExporterError(t *testing.T) {
+	bodies := make(chan map[string]interface{}, 1)
+	srv := intakeStandIn(t, bodies)
+	defer srv.Close()
+
+	spans, err := citestcycle.DecodeTraces(tracePayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewAgentlessExporter(srv.URL, "wrong")
+	if err := exporter.Export(citestcycle.NewEvents(spans)); err == nil {
+		t.Fatal("expected an error with a wrong API key")
+	}
+}
+
+func TestEVPProxy(t *testing.T) {
+	received := make(chan string, 1)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/info":
+			w.Write([]byte(`{"version":"7.40.0","endpoints":["/v0.4/traces","/evp_proxy/v2/"]}`))
+		case "/evp_proxy/v2/api/v2/citestcycle":
+			received <- r.Header.Get("X-Datadog-EVP-Subdomain")
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer agent.Close()
+
+	info, err := (&Agent{URL: agent.URL}).Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.HasEVPProxy() {
+		t.Fatal("the EVP proxy should be detected")
+	}
+
+	spans, err := citestcycle.DecodeTraces(tracePayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewEVPProxyExporter(&Agent{URL: agent.URL}).Export(citestcycle.NewEvents(spans)); err != nil {
+		t.Fatal(err)
+	}
+	if subdomain := <-received; subdomain != "citestcycle-intake" {
+		t.Fatalf("unexpected subdomain: %s", subdomain)
+	}
+}
+
+func TestAgentInfoWithoutEVPProxy(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version":"7.30.0","endpoints":["/v0.4/traces","/v0.6/stats"]}`))
+	}))
+	defer agent.Close()
+
+	info, err := (&Agent{URL: agent.URL}).Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.HasEVPProxy() {
+		t.Fatal("the EVP proxy should not be detected")
+	}
+}
+
+func TestNewAgent(t *testing.T) {
+	for _, tt := range []struct {
+		addr, host, port, expected string
+	}{
+		{"", "", "", "http://localhost:8126"},
+		{"agent:1234", "", "", "http://agent:1234"},
+		{"agent", "", "", "http://agent:8126"},
+		{"agent:1234", "other", "", "http://other:1234"},
+		{"", "", "4321", "http://localhost:4321"},
+	} {
+		os.Setenv("DD_AGENT_HOST", tt.host)
+		os.Setenv("DD_TRACE_AGENT_PORT", tt.port)
+		if url := NewAgent(tt.addr, nil).URL; url != tt.expected {
+			t.Errorf("expected %s for %q, got %s", tt.expected, tt.addr, url)
+		}
+	}
+	os.Unsetenv("DD_AGENT_HOST")
+	os.Unsetenv("DD_TRACE_AGENT_PORT")
+
+	agent, err := ParseAgentURL("http://agent:1234/")
+	if err != nil || agent.URL != "http://agent:1234" || agent.Transport != nil {
+		t.Errorf("unexpected agent %+v: %v", agent, err)
+	}
+	agent, err = ParseAgentURL("unix:///var/run/datadog/apm.socket")
+	if err != nil || agent.Transport == nil {
+		t.Errorf("expected a unix socket transport, got %+v: %v", agent, err)
+	}
+	for _, agentURL := range []string{"https://agent:1234", "unix://", "agent:1234"} {
+		if _, err := ParseAgentURL(agentURL); err == nil {
+			t.Errorf("expected an error parsing %s", agentURL)
+		}
+	}
+}
+
+// unixAgentStandIn starts a server listening on a unix socket and returns the path of the socket.
+func unixAgentStandIn(t *testing.T, handler http.HandlerFunc) (string, func()) {
+	dir, err := ioutil.TempDir("", "ddtesting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "apm.socket")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Skipf("unix sockets are not supported: %v", err)
+	}
+	srv := &httptest.Server{Listener: l, Config: &http.Server{Handler: handler}}
+	srv.Start()
+	return socket, func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestAgentInfoCached(t *testing.T) {
+	var requests int32
+	socket, cleanup := unixAgentStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{"version":"7.40.0","endpoints":["/v0.4/traces","/evp_proxy/v2/"]}`))
+	})
+	defer cleanup()
+
+	agent, err := ParseAgentURL("unix://" + socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if !agent.HasEVPProxy() {
+			t.Fatal("the EVP proxy should be detected through the unix socket")
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("expected the agent to be queried once, got %d requests", n)
+	}
+}
+
+// exporterFunc is an Exporter calling the function.
+type exporterFunc func(events []citestcycle.Event) error
+
+func (f exporterFunc) Export(events []citestcycle.Event) error { return f(events) }
+func (f exporterFunc) Close() error                            { return nil }
+
+func TestForwardingRoundTripperTransport(t *testing.T) {
+	received := make(chan string, 1)
+	socket, cleanup := unixAgentStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Path
+		w.Write([]byte("{}"))
+	})
+	defer cleanup()
+
+	var exported int
+	rt := NewForwardingRoundTripper(NewUDSTransport(socket), exporterFunc(func(events []citestcycle.Event) error {
+		exported += len(events)
+		return nil
+	}))
+	defer rt.Close()
+	req, _ := http.NewRequest("POST", "http://localhost:8126/v0.4/traces", bytes.NewReader(tracePayload()))
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if path := <-received; path != "/v0.4/traces" {
+		t.Fatalf("unexpected request forwarded through the unix socket: %s", path)
+	}
+	if exported != 1 {
+		t.Fatalf("expected the test to be exported, got %d events", exported)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ddtesting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.ndjson")
+
+	spans, err := citestcycle.DecodeTraces(tracePayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := citestcycle.NewEvents(spans)
+
+	// Several exporters on the same file behave as parallel test binaries.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		exporter, err := NewFileExporter(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer exporter.Close()
+			for j := 0; j < 50; j++ {
+				if err := exporter.Export(events); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	read, err := ReadEventsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 200 {
+		t.Fatalf("expected 200 events, got %d", len(read))
+	}
+	if read[0].Type != citestcycle.EventTypeTest || read[0].Content.SpanID != 42 {
+		t.Fatalf("unexpected event: %+v", read[0])
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer a b" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		received <- body
+	}))
+	defer collector.Close()
+
+	tags := func(extra map[string]string) map[string]string {
+		meta := map[string]string{
+			"ci.pipeline.id":   "42",
+			"git.branch":       "main",
+			"os.platform":      "linux",
+			"os.architecture":  "386",
+			"_dd.origin":       "ciapp-test",
+			"test.status":      "fail",
+			"ci.provider.name": "github",
+		}
+		for k, v := range extra {
+			meta[k] = v
+		}
+		return meta
+	}
+	events := []citestcycle.Event{
+		{Type: citestcycle.EventTypeTestSession, Content: citestcycle.Content{
+			TestSessionID: 1, Resource: "pkg.test", Service: "svc", Error: 1, Meta: tags(nil),
+		}},
+		{Type: citestcycle.EventTypeTestSuite, Content: citestcycle.Content{
+			TestSessionID: 1, TestModuleID: 2, TestSuiteID: 3, Resource: "pkg", Service: "svc", Error: 1, Meta: tags(nil),
+		}},
+		{Type: citestcycle.EventTypeTest, Content: citestcycle.Content{
+			TraceID: 100, SpanID: 4, TestSessionID: 1, TestModuleID: 2, TestSuiteID: 3, Resource: "pkg.TestA",
+			Service: "svc", Start: 10, Duration: 5, Error: 1,
+			Meta: tags(map[string]string{"test.name": "TestA", "error.msg": "boom", "error.type": "panic"}),
+		}},
+		{Type: citestcycle.EventTypeSpan, Content: citestcycle.Content{
+			TraceID: 100, SpanID: 5, ParentID: 4, Name: "db.query", Service: "svc", Meta: map[string]string{},
+		}},
+	}
+
+	os.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20a%20b")
+	defer os.Unsetenv("OTEL_EXPORTER_OTLP_HEADERS")
+	if err := NewOTLPExporterFromEnv(collector.URL).Export(events); err != nil {
+		t.Fatal(err)
+	}
+
+	body := <-received
+	resourceSpans := body["resourceSpans"].([]interface{})
+	if len(resourceSpans) != 1 {
+		t.Fatalf("expected a single resource, got %d", len(resourceSpans))
+	}
+	rs := resourceSpans[0].(map[string]interface{})
+	resource := attributes(rs["resource"].(map[string]interface{}))
+	if resource["service.name"] != "svc" || resource["os.type"] != "linux" || resource["host.arch"] != "x86" {
+		t.Fatalf("unexpected resource attributes: %v", resource)
+	}
+
+	spans := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d", len(spans))
+	}
+	sessionTrace := "00000000000000000000000000000001"
+	for i, expected := range []struct{ spanID, parentID string }{
+		{"0000000000000001", ""},
+		{"0000000000000003", "0000000000000002"},
+		{"0000000000000004", "0000000000000003"},
+		{"0000000000000005", "0000000000000004"},
+	} {
+		span := spans[i].(map[string]interface{})
+		parentID, _ := span["parentSpanId"].(string)
+		if span["traceId"] != sessionTrace || span["spanId"] != expected.spanID || parentID != expected.parentID {
+			t.Errorf("unexpected identifiers for span %d: %v %v %v", i, span["traceId"], span["spanId"], parentID)
+		}
+	}
+
+	test := spans[2].(map[string]interface{})
+	attrs := attributes(test)
+	for k, v := range map[string]string{
+		"cicd.pipeline.run.id":    "42",
+		"vcs.ref.head.name":       "main",
+		"vcs.ref.head.type":       "branch",
+		"test.case.name":          "TestA",
+		"test.case.result.status": "fail",
+		"ci.provider.name":        "github",
+	} {
+		if attrs[k] != v {
+			t.Errorf("expected attribute %s=%q, got %q", k, v, attrs[k])
+		}
+	}
+	for _, k := range []string{"_dd.origin", "os.type", "error.msg", "ci.pipeline.id"} {
+		if _, ok := attrs[k]; ok {
+			t.Errorf("unexpected attribute %s", k)
+		}
+	}
+	status := test["status"].(map[string]interface{})
+	if status["code"] != float64(2) || status["message"] != "boom" {
+		t.Errorf("unexpected status: %v", status)
+	}
+	if test["startTimeUnixNano"] != "10" || test["endTimeUnixNano"] != "15" {
+		t.Errorf("unexpected timestamps: %v %v", test["startTimeUnixNano"], test["endTimeUnixNano"])
+	}
+	exception := attributes(test["events"].([]interface{})[0].(map[string]interface{}))
+	if exception["exception.type"] != "panic" || exception["exception.message"] != "boom" {
+		t.Errorf("unexpected exception event: %v", exception)
+	}
+}
+
+func attributes(v map[string]interface{}) map[string]string {
+	attrs := map[string]string{}
+	list, _ := v["attributes"].([]interface{})
+	for _, item := range list {
+		kv := item.(map[string]interface{})
+		value := kv["value"].(map[string]interface{})
+		if s, ok := value["stringValue"].(string); ok {
+			attrs[kv["key"].(string)] = s
+		}
+	}
+	return attrs
+}
+
+func TestSpool(t *testing.T) {
+	defer func(min time.Duration) { spoolMinBackoff = min }(spoolMinBackoff)
+	spoolMinBackoff = time.Millisecond
+
+	dir, err := ioutil.TempDir("", "ddtesting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		mu        sync.Mutex
+		fail      error
+		delivered []string
+	)
+	spool := NewSpool(filepath.Join(dir, "spool"), 10, func(p []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail != nil {
+			return fail
+		}
+		delivered = append(delivered, string(p))
+		return nil
+	})
+	setFailure := func(err error) {
+		mu.Lock()
+		fail = err
+		mu.Unlock()
+	}
+
+	// Network errors are not retried until the destination has been reached.
+	setFailure(errors.New("connection refused"))
+	if err := spool.Send([]byte("a")); err == nil {
+		t.Fatal("the payload should be lost")
+	}
+	setFailure(nil)
+	if err := spool.Send([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The destination is now known to be reachable, the failed payloads are spooled in order.
+	setFailure(errors.New("connection refused"))
+	for _, p := range []string{"c", "d", "e"} {
+		if err := spool.Send([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := spool.Send([]byte("too large")); err == nil {
+		t.Fatal("the payload should not fit in the spool")
+	}
+	if n := spool.Drain(10 * time.Millisecond); n != 5 {
+		t.Fatalf("expected 5 undelivered payloads, got %d", n)
+	}
+	setFailure(&permanentError{errors.New("rejected")})
+	if err := spool.Send([]byte("f")); err != nil {
+		t.Fatal(err)
+	}
+	setFailure(nil)
+	if n := spool.Close(time.Second); n != 2 {
+		t.Fatalf("expected 2 undelivered payloads, got %d", n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(delivered, "") != "bcdef" {
+		t.Fatalf("unexpected delivered payloads: %v", delivered)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "spool")); !os.IsNotExist(err) {
+		t.Fatal("the spool directory should be removed")
+	}
+}
+
+func TestRoundTripperSpoolsAgentPayloads(t *testing.T) {
+	defer func(min time.Duration) { spoolMinBackoff = min }(spoolMinBackoff)
+	spoolMinBackoff = time.Millisecond
+	const rates = `{"rate_by_service":{"service:,env:":1}}`
+
+	var (
+		mu       sync.Mutex
+		requests int
+		received []string
+	)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		// The agent restarts after the first payload.
+		if requests == 2 || requests == 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, r.Header.Get("Content-Type")+" "+string(body))
+		w.Write([]byte(rates))
+	}))
+	defer agent.Close()
+
+	rt := NewForwardingRoundTripper(nil)
+	for _, tt := range []struct {
+		payload, response string
+	}{
+		// The tracer gets the sampling rates of the agent.
+		{"first", rates},
+		// The payload is retried from the spool, the tracer gets a local response.
+		{"second", "{}"},
+	} {
+		req, _ := http.NewRequest("POST", agent.URL+"/v0.4/traces", strings.NewReader(tt.payload))
+		req.Header.Set("Content-Type", "application/msgpack")
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != tt.response {
+			t.Fatalf("unexpected response to the %s payload: %d %s", tt.payload, resp.StatusCode, body)
+		}
+	}
+	if n := rt.Drain(5 * time.Second); n != 0 {
+		t.Fatalf("expected all the payloads to be delivered, %d were not", n)
+	}
+	if err := rt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(received, ",") != "application/msgpack first,application/msgpack second" {
+		t.Fatalf("unexpected payloads: %v", received)
+	}
+}
@@ -8,8 +8,12 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
@@ -31,6 +35,47 @@ var providers = map[string]providerType{
 	"TEAMCITY_VERSION":   extractTeamcity,
 	"TRAVIS":             extractTravis,
 	"BITRISE_BUILD_SLUG": extractBitrise,
+	"CODEBUILD_BUILD_ID": extractAWSCodeBuild,
+	"CF_BUILD_ID":        extractCodefresh,
+	"DRONE":              extractDrone,
+	"BUILDER_OUTPUT":     extractGoogleCloudBuild,
+	"HARNESS_BUILD_ID":   extractHarness,
+	"SEMAPHORE":          extractSemaphore,
+	"CI=woodpecker":      extractWoodpecker,
+}
+
+// shadowedProviders are the keys of the providers whose variables are also set by the provider of a
+// key, e.g. Harness CI sets the Drone variables, and which aren't detected then.
+var shadowedProviders = map[string][]string{
+	"HARNESS_BUILD_ID": {"DRONE"},
+}
+
+// providerEnv returns the environment variable detecting a provider, and the value it must have
+// for the keys of the form NAME=value, used for the variables set by several providers.
+func providerEnv(key string) (name, value string) {
+	if kv := strings.SplitN(key, "=", 2); len(kv) == 2 {
+		return kv[0], kv[1]
+	}
+	return key, ""
+}
+
+// detected reports whether the provider of the given key runs the tests.
+func detected(key string) bool {
+	name, expected := providerEnv(key)
+	value, ok := os.LookupEnv(name)
+	return ok && (expected == "" || value == expected)
+}
+
+// shadowed reports whether the provider of the given key is shadowed by another provider detected.
+func shadowed(key string) bool {
+	for by, keys := range shadowedProviders {
+		for _, k := range keys {
+			if k == key && detected(by) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func removeEmpty(tags map[string]string) {
@@ -43,16 +88,49 @@ func removeEmpty(tags map[string]string) {
 
 // GetProviderTags extracts CI information from environment variables.
 func GetProviderTags() map[string]string {
-	tags := map[string]string{}
-	for key, provider := range providers {
-		if _, ok := os.LookupEnv(key); !ok {
-			continue
+	return getProviderTags(newDiagnostics())
+}
+
+func getProviderTags(diag *Diagnostics) map[string]string {
+	loadProviderConfigFromEnv(diag)
+	customProvidersMu.RLock()
+	defer customProvidersMu.RUnlock()
+
+	var (
+		matched []string
+		extract providerType
+	)
+	// The keys are sorted so that the same provider is used when several are detected, and the
+	// custom providers are detected last, to take precedence.
+	for _, registry := range []map[string]providerType{providers, customProviders} {
+		keys := make([]string, 0, len(registry))
+		for key := range registry {
+			keys = append(keys, key)
 		}
-		tags = provider()
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !detected(key) || shadowed(key) {
+				continue
+			}
+			extract = registry[key]
+			matched = append(matched, key)
+		}
+	}
+	tags := map[string]string{}
+	if extract != nil {
+		// The extractor may return nil, or a map it keeps.
+		tags = copyTags(extract())
+	}
+	diag.Provider = tags[constants.CIProviderName]
+	if len(matched) > 1 {
+		diag.addWarning("several CI providers detected by %s, using %s", strings.Join(matched, ", "), diag.Provider)
 	}
+	diag.track(nil, tags, SourceProvider)
 
 	// replace with user specific tags
+	before := copyTags(tags)
 	replaceWithUserSpecificTags(tags)
+	diag.track(before, tags, SourceOverride)
 
 	// Normalize tags
 	normalizeTags(tags)
@@ -84,6 +162,9 @@ func normalizeTags(tags map[string]string) {
 	if tag, ok := tags[constants.GitRepositoryURL]; ok && tag != "" {
 		tags[constants.GitRepositoryURL] = filterSensitiveInfo(tag)
 	}
+	if tag, ok := tags[constants.GitPullRequestBaseBranch]; ok && tag != "" {
+		tags[constants.GitPullRequestBaseBranch] = normalizeRef(tag)
+	}
 }
 
 func replaceWithUserSpecificTags(tags map[string]string) {
@@ -103,6 +184,7 @@ func replaceWithUserSpecificTags(tags map[string]string) {
 	replace(constants.GitCommitCommitterName, "DD_GIT_COMMIT_COMMITTER_NAME")
 	replace(constants.GitCommitCommitterEmail, "DD_GIT_COMMIT_COMMITTER_EMAIL")
 	replace(constants.GitCommitCommitterDate, "DD_GIT_COMMIT_COMMITTER_DATE")
+	replace(constants.GitPullRequestBaseBranch, "DD_CIVISIBILITY_BASE_BRANCH")
 }
 
 func getEnvironmentVariableIfIsNotEmpty(key string, defaultValue string) string {
@@ -137,6 +219,24 @@ func lookupEnvs(keys ...string) ([]string, bool) {
 	return values, true
 }
 
+// nodeLabels returns the non-empty labels as a JSON array, or an empty string if there are none.
+func nodeLabels(labels []string) string {
+	var values []string
+	for _, label := range labels {
+		if label = strings.TrimSpace(label); label != "" {
+			values = append(values, label)
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	jsonString, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+	return string(jsonString)
+}
+
 func firstEnv(keys ...string) string {
 	for _, key := range keys {
 		if value, ok := os.LookupEnv(key); ok {
@@ -171,6 +271,66 @@ func extractAppveyor() map[string]string {
 	tags[constants.GitCommitMessage] = fmt.Sprintf("%s\n%s", os.Getenv("APPVEYOR_REPO_COMMIT_MESSAGE"), os.Getenv("APPVEYOR_REPO_COMMIT_MESSAGE_EXTENDED"))
 	tags[constants.GitCommitAuthorName] = os.Getenv("APPVEYOR_REPO_COMMIT_AUTHOR")
 	tags[constants.GitCommitAuthorEmail] = os.Getenv("APPVEYOR_REPO_COMMIT_AUTHOR_EMAIL")
+	if pr := os.Getenv("APPVEYOR_PULL_REQUEST_NUMBER"); pr != "" {
+		tags[constants.PullRequestNumber] = pr
+		tags[constants.GitPullRequestBaseBranch] = os.Getenv("APPVEYOR_REPO_BRANCH")
+		tags[constants.GitCommitHeadSHA] = os.Getenv("APPVEYOR_PULL_REQUEST_HEAD_COMMIT")
+	}
+	return tags
+}
+
+func extractAWSCodeBuild() map[string]string {
+	tags := map[string]string{}
+	region := os.Getenv("AWS_REGION")
+	buildID := os.Getenv("CODEBUILD_BUILD_ID")
+	// The build ID is <project>:<uuid>.
+	project := strings.SplitN(buildID, ":", 2)[0]
+	buildURL := fmt.Sprintf("https://%s.console.aws.amazon.com/codesuite/codebuild/projects/%s/build/%s", region, project, strings.Replace(buildID, ":", "%3A", 1))
+
+	envVarsMap := map[string]string{
+		"CODEBUILD_BUILD_ARN": os.Getenv("CODEBUILD_BUILD_ARN"),
+	}
+	if initiator := os.Getenv("CODEBUILD_INITIATOR"); strings.HasPrefix(initiator, "codepipeline/") {
+		// The build is an action of a CodePipeline execution, whose ID must be exposed by the pipeline
+		// as DD_PIPELINE_EXECUTION_ID.
+		pipeline := strings.TrimPrefix(initiator, "codepipeline/")
+		executionID := os.Getenv("DD_PIPELINE_EXECUTION_ID")
+		tags[constants.CIProviderName] = "awscodepipeline"
+		tags[constants.CIPipelineID] = executionID
+		tags[constants.CIPipelineName] = pipeline
+		tags[constants.CIPipelineURL] = fmt.Sprintf("https://%s.console.aws.amazon.com/codesuite/codepipeline/pipelines/%s/executions/%s/timeline", region, pipeline, executionID)
+		envVarsMap["DD_PIPELINE_EXECUTION_ID"] = executionID
+		envVarsMap["DD_ACTION_EXECUTION_ID"] = os.Getenv("DD_ACTION_EXECUTION_ID")
+	} else {
+		tags[constants.CIProviderName] = "awscodebuild"
+		tags[constants.CIPipelineID] = buildID
+		tags[constants.CIPipelineName] = project
+		tags[constants.CIPipelineNumber] = os.Getenv("CODEBUILD_BUILD_NUMBER")
+		tags[constants.CIPipelineURL] = buildURL
+	}
+	tags[constants.CIJobName] = project
+	tags[constants.CIJobURL] = buildURL
+	tags[constants.CIWorkspacePath] = os.Getenv("CODEBUILD_SRC_DIR")
+
+	tags[constants.GitRepositoryURL] = os.Getenv("CODEBUILD_SOURCE_REPO_URL")
+	tags[constants.GitCommitSHA] = os.Getenv("CODEBUILD_RESOLVED_SOURCE_VERSION")
+	branchOrTag := os.Getenv("CODEBUILD_WEBHOOK_HEAD_REF")
+	if strings.Contains(branchOrTag, "tags/") {
+		tags[constants.GitTag] = branchOrTag
+	} else {
+		tags[constants.GitBranch] = branchOrTag
+	}
+	if pr := strings.TrimPrefix(os.Getenv("CODEBUILD_WEBHOOK_TRIGGER"), "pr/"); pr != os.Getenv("CODEBUILD_WEBHOOK_TRIGGER") {
+		tags[constants.PullRequestNumber] = pr
+		tags[constants.GitPullRequestBaseBranch] = os.Getenv("CODEBUILD_WEBHOOK_BASE_REF")
+	}
+
+	removeEmpty(envVarsMap)
+	jsonString, err := json.Marshal(envVarsMap)
+	if err == nil {
+		tags[constants.CIEnvVars] = string(jsonString)
+	}
+
 	return tags
 }
 
@@ -199,6 +359,7 @@ func extractAzurePipelines() map[string]string {
 
 	tags[constants.CIJobName] = os.Getenv("SYSTEM_JOBDISPLAYNAME")
 	tags[constants.CIJobURL] = jobURL
+	tags[constants.CINodeName] = os.Getenv("AGENT_NAME")
 
 	tags[constants.GitRepositoryURL] = firstEnv("SYSTEM_PULLREQUEST_SOURCEREPOSITORYURI", "BUILD_REPOSITORY_URI")
 	tags[constants.GitCommitSHA] = firstEnv("SYSTEM_PULLREQUEST_SOURCECOMMITID", "BUILD_SOURCEVERSION")
@@ -207,6 +368,9 @@ func extractAzurePipelines() map[string]string {
 	tags[constants.GitCommitMessage] = os.Getenv("BUILD_SOURCEVERSIONMESSAGE")
 	tags[constants.GitCommitAuthorName] = os.Getenv("BUILD_REQUESTEDFORID")
 	tags[constants.GitCommitAuthorEmail] = os.Getenv("BUILD_REQUESTEDFOREMAIL")
+	tags[constants.GitPullRequestBaseBranch] = os.Getenv("SYSTEM_PULLREQUEST_TARGETBRANCH")
+	tags[constants.GitCommitHeadSHA] = os.Getenv("SYSTEM_PULLREQUEST_SOURCECOMMITID")
+	tags[constants.PullRequestNumber] = firstEnv("SYSTEM_PULLREQUEST_PULLREQUESTNUMBER", "SYSTEM_PULLREQUEST_PULLREQUESTID")
 
 	envVarsMap := map[string]string{
 		"SYSTEM_TEAMPROJECTID": os.Getenv("SYSTEM_TEAMPROJECTID"),
@@ -235,6 +399,8 @@ func extractBitrise() map[string]string {
 	tags[constants.CIPipelineNumber] = os.Getenv("BITRISE_BUILD_NUMBER")
 	tags[constants.CIPipelineURL] = os.Getenv("BITRISE_BUILD_URL")
 	tags[constants.GitCommitMessage] = os.Getenv("BITRISE_GIT_MESSAGE")
+	tags[constants.GitPullRequestBaseBranch] = os.Getenv("BITRISEIO_GIT_BRANCH_DEST")
+	tags[constants.PullRequestNumber] = os.Getenv("BITRISE_PULL_REQUEST")
 	return tags
 }
 
@@ -252,6 +418,12 @@ func extractBitbucket() map[string]string {
 	tags[constants.CIPipelineName] = os.Getenv("BITBUCKET_REPO_FULL_NAME")
 	tags[constants.CIPipelineURL] = url
 	tags[constants.CIJobURL] = url
+	if pr := os.Getenv("BITBUCKET_PR_ID"); pr != "" {
+		tags[constants.PullRequestNumber] = pr
+		tags[constants.GitPullRequestBaseBranch] = os.Getenv("BITBUCKET_PR_DESTINATION_BRANCH")
+		tags[constants.GitPullRequestBaseBranchSHA] = os.Getenv("BITBUCKET_PR_DESTINATION_COMMIT")
+		tags[constants.GitCommitHeadSHA] = os.Getenv("BITBUCKET_COMMIT")
+	}
 	return tags
 }
 
@@ -269,6 +441,8 @@ func extractBuddy() map[string]string {
 	tags[constants.GitCommitMessage] = os.Getenv("BUDDY_EXECUTION_REVISION_MESSAGE")
 	tags[constants.GitCommitCommitterName] = os.Getenv("BUDDY_EXECUTION_REVISION_COMMITTER_NAME")
 	tags[constants.GitCommitCommitterEmail] = os.Getenv("BUDDY_EXECUTION_REVISION_COMMITTER_EMAIL")
+	tags[constants.GitPullRequestBaseBranch] = os.Getenv("BUDDY_EXECUTION_PULL_REQUEST_BASE_BRANCH")
+	tags[constants.PullRequestNumber] = os.Getenv("BUDDY_EXECUTION_PULL_REQUEST_NO")
 	return tags
 }
 
@@ -288,6 +462,24 @@ func extractBuildkite() map[string]string {
 	tags[constants.GitCommitMessage] = os.Getenv("BUILDKITE_MESSAGE")
 	tags[constants.GitCommitAuthorName] = os.Getenv("BUILDKITE_BUILD_AUTHOR")
 	tags[constants.GitCommitAuthorEmail] = os.Getenv("BUILDKITE_BUILD_AUTHOR_EMAIL")
+	tags[constants.CINodeName] = firstEnv("BUILDKITE_AGENT_NAME", "BUILDKITE_AGENT_ID")
+
+	// The agent metadata are exposed as BUILDKITE_AGENT_META_DATA_<KEY>=<value>.
+	var labels []string
+	for _, env := range os.Environ() {
+		kv := strings.SplitN(env, "=", 2)
+		if key := strings.TrimPrefix(kv[0], "BUILDKITE_AGENT_META_DATA_"); key != kv[0] && len(kv) == 2 {
+			labels = append(labels, fmt.Sprintf("%s:%s", strings.ToLower(key), kv[1]))
+		}
+	}
+	sort.Strings(labels)
+	tags[constants.CINodeLabels] = nodeLabels(labels)
+
+	if pr := os.Getenv("BUILDKITE_PULL_REQUEST"); pr != "" && pr != "false" {
+		tags[constants.PullRequestNumber] = pr
+		tags[constants.GitPullRequestBaseBranch] = os.Getenv("BUILDKITE_PULL_REQUEST_BASE_BRANCH")
+		tags[constants.GitCommitHeadSHA] = os.Getenv("BUILDKITE_COMMIT")
+	}
 
 	envVarsMap := map[string]string{
 		"BUILDKITE_BUILD_ID": os.Getenv("BUILDKITE_BUILD_ID"),
@@ -330,6 +522,65 @@ func extractCircleCI() map[string]string {
 	return tags
 }
 
+func extractCodefresh() map[string]string {
+	tags := map[string]string{}
+	tags[constants.CIProviderName] = "codefresh"
+	tags[constants.CIPipelineID] = os.Getenv("CF_BUILD_ID")
+	tags[constants.CIPipelineName] = os.Getenv("CF_PIPELINE_NAME")
+	tags[constants.CIPipelineURL] = os.Getenv("CF_BUILD_URL")
+	tags[constants.CIJobName] = os.Getenv("CF_STEP_NAME")
+
+	tags[constants.GitCommitSHA] = os.Getenv("CF_REVISION")
+	branchOrTag := os.Getenv("CF_BRANCH")
+	if os.Getenv("CF_BUILD_TRIGGER") == "tag" || strings.Contains(branchOrTag, "tags/") {
+		tags[constants.GitTag] = branchOrTag
+	} else {
+		tags[constants.GitBranch] = branchOrTag
+	}
+	tags[constants.GitCommitMessage] = os.Getenv("CF_COMMIT_MESSAGE")
+	tags[constants.GitCommitAuthorName] = os.Getenv("CF_COMMIT_AUTHOR")
+	if pr := os.Getenv("CF_PULL_REQUEST_NUMBER"); pr != "" {
+		tags[constants.PullRequestNumber] = pr
+		tags[constants.GitPullRequestBaseBranch] = os.Getenv("CF_PULL_REQUEST_TARGET")
+	}
+
+	envVarsMap := map[string]string{
+		"CF_BUILD_ID": os.Getenv("CF_BUILD_ID"),
+	}
+	removeEmpty(envVarsMap)
+	jsonString, err := json.Marshal(envVarsMap)
+	if err == nil {
+		tags[constants.CIEnvVars] = string(jsonString)
+	}
+
+	return tags
+}
+
+func extractDrone() map[string]string {
+	tags := map[string]string{}
+	tags[constants.CIProviderName] = "drone"
+	tags[constants.CIPipelineNumber] = os.Getenv("DRONE_BUILD_NUMBER")
+	tags[constants.CIPipelineName] = os.Getenv("DRONE_REPO")
+	tags[constants.CIPipelineURL] = os.Getenv("DRONE_BUILD_LINK")
+	tags[constants.CIStageName] = os.Getenv("DRONE_STAGE_NAME")
+	tags[constants.CIJobName] = os.Getenv("DRONE_STEP_NAME")
+	tags[constants.CIWorkspacePath] = os.Getenv("DRONE_WORKSPACE")
+	tags[constants.CINodeName] = os.Getenv("DRONE_RUNNER_HOSTNAME")
+
+	tags[constants.GitRepositoryURL] = os.Getenv("DRONE_GIT_HTTP_URL")
+	tags[constants.GitCommitSHA] = os.Getenv("DRONE_COMMIT_SHA")
+	tags[constants.GitBranch] = os.Getenv("DRONE_BRANCH")
+	tags[constants.GitTag] = os.Getenv("DRONE_TAG")
+	tags[constants.GitCommitMessage] = os.Getenv("DRONE_COMMIT_MESSAGE")
+	tags[constants.GitCommitAuthorName] = os.Getenv("DRONE_COMMIT_AUTHOR_NAME")
+	tags[constants.GitCommitAuthorEmail] = os.Getenv("DRONE_COMMIT_AUTHOR_EMAIL")
+	if pr := os.Getenv("DRONE_PULL_REQUEST"); pr != "" {
+		tags[constants.PullRequestNumber] = pr
+		tags[constants.GitPullRequestBaseBranch] = os.Getenv("DRONE_TARGET_BRANCH")
+	}
+	return tags
+}
+
 func extractGithubActions() map[string]string {
 	tags := map[string]string{}
 	branchOrTag := firstEnv("GITHUB_HEAD_REF", "GITHUB_REF")
@@ -362,6 +613,9 @@ func extractGithubActions() map[string]string {
 	tags[constants.CIPipelineName] = os.Getenv("GITHUB_WORKFLOW")
 	tags[constants.CIJobURL] = fmt.Sprintf("%s/commit/%s/checks", rawRepository, commitSha)
 	tags[constants.CIJobName] = os.Getenv("GITHUB_JOB")
+	tags[constants.CINodeName] = os.Getenv("RUNNER_NAME")
+	tags[constants.GitPullRequestBaseBranch] = os.Getenv("GITHUB_BASE_REF")
+	extractGithubEvent(tags)
 
 	attempts := os.Getenv("GITHUB_RUN_ATTEMPT")
 	if attempts == "" {
@@ -385,6 +639,71 @@ func extractGithubActions() map[string]string {
 	return tags
 }
 
+// githubEvent is the part of the webhook payload of the event triggering a GitHub Actions workflow
+// describing a pull request.
+type githubEvent struct {
+	PullRequest *struct {
+		Number int `json:"number"`
+		Head   struct {
+			SHA string `json:"sha"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		} `json:"base"`
+	} `json:"pull_request"`
+}
+
+// extractGithubEvent adds the pull request tags from the event payload at GITHUB_EVENT_PATH.
+func extractGithubEvent(tags map[string]string) {
+	path := os.Getenv("GITHUB_EVENT_PATH")
+	if path == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var event githubEvent
+	if err := json.Unmarshal(data, &event); err != nil || event.PullRequest == nil {
+		return
+	}
+	if event.PullRequest.Number > 0 {
+		tags[constants.PullRequestNumber] = strconv.Itoa(event.PullRequest.Number)
+	}
+	tags[constants.GitCommitHeadSHA] = event.PullRequest.Head.SHA
+	tags[constants.GitPullRequestBaseBranchSHA] = event.PullRequest.Base.SHA
+	if tags[constants.GitPullRequestBaseBranch] == "" {
+		tags[constants.GitPullRequestBaseBranch] = event.PullRequest.Base.Ref
+	}
+}
+
+func extractGoogleCloudBuild() map[string]string {
+	// The substitutions of the build must be passed to the step as environment variables.
+	tags := map[string]string{}
+	tags[constants.CIProviderName] = "googlecloudbuild"
+	tags[constants.CIPipelineID] = os.Getenv("BUILD_ID")
+	tags[constants.CIPipelineName] = os.Getenv("TRIGGER_NAME")
+	if buildID := os.Getenv("BUILD_ID"); buildID != "" {
+		location := os.Getenv("LOCATION")
+		if location == "" {
+			location = "global"
+		}
+		tags[constants.CIPipelineURL] = fmt.Sprintf("https://console.cloud.google.com/cloud-build/builds;region=%s/%s?project=%s", location, buildID, os.Getenv("PROJECT_ID"))
+	}
+	tags[constants.CIWorkspacePath] = "/workspace"
+
+	tags[constants.GitRepositoryURL] = os.Getenv("_HEAD_REPO_URL")
+	tags[constants.GitCommitSHA] = os.Getenv("COMMIT_SHA")
+	tags[constants.GitBranch] = firstEnv("_HEAD_BRANCH", "BRANCH_NAME")
+	tags[constants.GitTag] = os.Getenv("TAG_NAME")
+	if pr := os.Getenv("_PR_NUMBER"); pr != "" {
+		tags[constants.PullRequestNumber] = pr
+		tags[constants.GitPullRequestBaseBranch] = os.Getenv("_BASE_BRANCH")
+	}
+	return tags
+}
+
 func extractGitlab() map[string]string {
 	tags := map[string]string{}
 	url := os.Getenv("CI_PIPELINE_URL")
@@ -405,6 +724,14 @@ func extractGitlab() map[string]string {
 	tags[constants.CIJobName] = os.Getenv("CI_JOB_NAME")
 	tags[constants.CIStageName] = os.Getenv("CI_JOB_STAGE")
 	tags[constants.GitCommitMessage] = os.Getenv("CI_COMMIT_MESSAGE")
+	tags[constants.CINodeName] = os.Getenv("CI_RUNNER_ID")
+
+	// The runner tags are a JSON array in recent versions of GitLab, and a comma-separated list before.
+	var runnerTags []string
+	if err := json.Unmarshal([]byte(os.Getenv("CI_RUNNER_TAGS")), &runnerTags); err != nil {
+		runnerTags = strings.Split(os.Getenv("CI_RUNNER_TAGS"), ",")
+	}
+	tags[constants.CINodeLabels] = nodeLabels(runnerTags)
 
 	author := os.Getenv("CI_COMMIT_AUTHOR")
 	authorArray := strings.FieldsFunc(author, func(s rune) bool {
@@ -413,6 +740,10 @@ func extractGitlab() map[string]string {
 	tags[constants.GitCommitAuthorName] = strings.TrimSpace(authorArray[0])
 	tags[constants.GitCommitAuthorEmail] = strings.TrimSpace(authorArray[1])
 	tags[constants.GitCommitAuthorDate] = os.Getenv("CI_COMMIT_TIMESTAMP")
+	tags[constants.PullRequestNumber] = os.Getenv("CI_MERGE_REQUEST_IID")
+	tags[constants.GitPullRequestBaseBranch] = os.Getenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME")
+	tags[constants.GitPullRequestBaseBranchSHA] = firstEnv("CI_MERGE_REQUEST_TARGET_BRANCH_SHA", "CI_MERGE_REQUEST_DIFF_BASE_SHA")
+	tags[constants.GitCommitHeadSHA] = os.Getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_SHA")
 
 	envVarsMap := map[string]string{
 		"CI_PROJECT_URL": os.Getenv("CI_PROJECT_URL"),
@@ -428,6 +759,31 @@ func extractGitlab() map[string]string {
 	return tags
 }
 
+func extractHarness() map[string]string {
+	tags := map[string]string{}
+	tags[constants.CIProviderName] = "harness"
+	tags[constants.CIPipelineID] = os.Getenv("HARNESS_EXECUTION_ID")
+	tags[constants.CIPipelineName] = os.Getenv("HARNESS_PIPELINE_ID")
+	tags[constants.CIPipelineNumber] = os.Getenv("HARNESS_BUILD_ID")
+	tags[constants.CIPipelineURL] = firstEnv("CI_BUILD_LINK", "DRONE_BUILD_LINK")
+	tags[constants.CIStageName] = os.Getenv("HARNESS_STAGE_ID")
+	tags[constants.CIJobName] = os.Getenv("HARNESS_STEP_ID")
+	tags[constants.CIWorkspacePath] = firstEnv("HARNESS_WORKSPACE", "DRONE_WORKSPACE")
+
+	tags[constants.GitRepositoryURL] = os.Getenv("DRONE_GIT_HTTP_URL")
+	tags[constants.GitCommitSHA] = os.Getenv("DRONE_COMMIT_SHA")
+	tags[constants.GitBranch] = firstEnv("DRONE_SOURCE_BRANCH", "DRONE_BRANCH")
+	tags[constants.GitTag] = os.Getenv("DRONE_TAG")
+	tags[constants.GitCommitMessage] = os.Getenv("DRONE_COMMIT_MESSAGE")
+	tags[constants.GitCommitAuthorName] = os.Getenv("DRONE_COMMIT_AUTHOR_NAME")
+	tags[constants.GitCommitAuthorEmail] = os.Getenv("DRONE_COMMIT_AUTHOR_EMAIL")
+	if pr := os.Getenv("DRONE_PULL_REQUEST"); pr != "" {
+		tags[constants.PullRequestNumber] = pr
+		tags[constants.GitPullRequestBaseBranch] = os.Getenv("DRONE_TARGET_BRANCH")
+	}
+	return tags
+}
+
 func extractJenkins() map[string]string {
 	tags := map[string]string{}
 	tags[constants.CIProviderName] = "jenkins"
@@ -457,6 +813,13 @@ func extractJenkins() map[string]string {
 	tags[constants.CIPipelineNumber] = os.Getenv("BUILD_NUMBER")
 	tags[constants.CIPipelineName] = name
 	tags[constants.CIPipelineURL] = os.Getenv("BUILD_URL")
+	tags[constants.CINodeName] = os.Getenv("NODE_NAME")
+	tags[constants.CINodeLabels] = nodeLabels(strings.Fields(os.Getenv("NODE_LABELS")))
+	if pr := os.Getenv("CHANGE_ID"); pr != "" {
+		tags[constants.PullRequestNumber] = pr
+		tags[constants.GitPullRequestBaseBranch] = os.Getenv("CHANGE_TARGET")
+		tags[constants.GitCommitHeadSHA] = os.Getenv("GIT_COMMIT")
+	}
 
 	envVarsMap := map[string]string{
 		"DD_CUSTOM_TRACE_ID": os.Getenv("DD_CUSTOM_TRACE_ID"),
@@ -470,6 +833,45 @@ func extractJenkins() map[string]string {
 	return tags
 }
 
+func extractSemaphore() map[string]string {
+	tags := map[string]string{}
+	orgURL := strings.TrimSuffix(os.Getenv("SEMAPHORE_ORGANIZATION_URL"), "/")
+	tags[constants.CIProviderName] = "semaphore"
+	tags[constants.CIPipelineID] = os.Getenv("SEMAPHORE_WORKFLOW_ID")
+	tags[constants.CIPipelineName] = os.Getenv("SEMAPHORE_PROJECT_NAME")
+	tags[constants.CIPipelineNumber] = os.Getenv("SEMAPHORE_WORKFLOW_NUMBER")
+	if workflowID := os.Getenv("SEMAPHORE_WORKFLOW_ID"); orgURL != "" && workflowID != "" {
+		tags[constants.CIPipelineURL] = fmt.Sprintf("%s/workflows/%s", orgURL, workflowID)
+	}
+	tags[constants.CIJobName] = os.Getenv("SEMAPHORE_JOB_NAME")
+	if jobID := os.Getenv("SEMAPHORE_JOB_ID"); orgURL != "" && jobID != "" {
+		tags[constants.CIJobURL] = fmt.Sprintf("%s/jobs/%s", orgURL, jobID)
+	}
+	// The repository is cloned in SEMAPHORE_GIT_DIR, relative to the home directory.
+	if dir := os.Getenv("SEMAPHORE_GIT_DIR"); dir != "" && !filepath.IsAbs(dir) {
+		tags[constants.CIWorkspacePath] = "~/" + dir
+	} else {
+		tags[constants.CIWorkspacePath] = dir
+	}
+
+	tags[constants.GitRepositoryURL] = os.Getenv("SEMAPHORE_GIT_URL")
+	tags[constants.GitCommitSHA] = os.Getenv("SEMAPHORE_GIT_SHA")
+	tags[constants.GitCommitAuthorName] = os.Getenv("SEMAPHORE_GIT_COMMIT_AUTHOR")
+	switch os.Getenv("SEMAPHORE_GIT_REF_TYPE") {
+	case "tag":
+		tags[constants.GitTag] = os.Getenv("SEMAPHORE_GIT_TAG_NAME")
+	case "pull-request":
+		// SEMAPHORE_GIT_BRANCH is the base branch of pull requests.
+		tags[constants.GitBranch] = os.Getenv("SEMAPHORE_GIT_PR_BRANCH")
+		tags[constants.GitCommitHeadSHA] = os.Getenv("SEMAPHORE_GIT_PR_SHA")
+		tags[constants.PullRequestNumber] = os.Getenv("SEMAPHORE_GIT_PR_NUMBER")
+		tags[constants.GitPullRequestBaseBranch] = os.Getenv("SEMAPHORE_GIT_BRANCH")
+	default:
+		tags[constants.GitBranch] = os.Getenv("SEMAPHORE_GIT_BRANCH")
+	}
+	return tags
+}
+
 func extractTeamcity() map[string]string {
 	tags := map[string]string{}
 	tags[constants.CIProviderName] = "teamcity"
@@ -501,5 +903,38 @@ func extractTravis() map[string]string {
 	tags[constants.CIPipelineURL] = os.Getenv("TRAVIS_BUILD_WEB_URL")
 	tags[constants.CIJobURL] = os.Getenv("TRAVIS_JOB_WEB_URL")
 	tags[constants.GitCommitMessage] = os.Getenv("TRAVIS_COMMIT_MESSAGE")
+	if pr := os.Getenv("TRAVIS_PULL_REQUEST"); pr != "" && pr != "false" {
+		tags[constants.PullRequestNumber] = pr
+		tags[constants.GitPullRequestBaseBranch] = os.Getenv("TRAVIS_BRANCH")
+		tags[constants.GitCommitHeadSHA] = os.Getenv("TRAVIS_PULL_REQUEST_SHA")
+	}
+	return tags
+}
+
+func extractWoodpecker() map[string]string {
+	tags := map[string]string{}
+	tags[constants.CIProviderName] = "woodpecker"
+	tags[constants.CIPipelineNumber] = os.Getenv("CI_PIPELINE_NUMBER")
+	tags[constants.CIPipelineName] = os.Getenv("CI_REPO")
+	tags[constants.CIPipelineURL] = os.Getenv("CI_PIPELINE_URL")
+	tags[constants.CIStageName] = os.Getenv("CI_WORKFLOW_NAME")
+	tags[constants.CIJobName] = os.Getenv("CI_STEP_NAME")
+	tags[constants.CIJobURL] = os.Getenv("CI_STEP_URL")
+	tags[constants.CIWorkspacePath] = os.Getenv("CI_WORKSPACE")
+
+	tags[constants.GitRepositoryURL] = os.Getenv("CI_REPO_CLONE_URL")
+	tags[constants.GitCommitSHA] = os.Getenv("CI_COMMIT_SHA")
+	tags[constants.GitTag] = os.Getenv("CI_COMMIT_TAG")
+	tags[constants.GitCommitMessage] = os.Getenv("CI_COMMIT_MESSAGE")
+	tags[constants.GitCommitAuthorName] = os.Getenv("CI_COMMIT_AUTHOR")
+	tags[constants.GitCommitAuthorEmail] = os.Getenv("CI_COMMIT_AUTHOR_EMAIL")
+	if pr := os.Getenv("CI_COMMIT_PULL_REQUEST"); pr != "" {
+		// CI_COMMIT_BRANCH is the target branch of pull requests.
+		tags[constants.GitBranch] = os.Getenv("CI_COMMIT_SOURCE_BRANCH")
+		tags[constants.PullRequestNumber] = pr
+		tags[constants.GitPullRequestBaseBranch] = firstEnv("CI_COMMIT_TARGET_BRANCH", "CI_COMMIT_BRANCH")
+	} else {
+		tags[constants.GitBranch] = os.Getenv("CI_COMMIT_BRANCH")
+	}
 	return tags
 }
@@ -13,6 +13,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
 )
 
 func setEnvs(env map[string]string) func() {
@@ -49,6 +51,7 @@ func TestTags(t *testing.T) {
 	// Reset provider env key when running in CI
 	resetProviders := map[string]string{}
 	for key := range providers {
+		key, _ := providerEnv(key)
 		if value, ok := os.LookupEnv(key); ok {
 			resetProviders[key] = value
 			os.Unsetenv(key)
@@ -121,3 +124,38 @@ func TestTags(t *testing.T) {
 		})
 	}
 }
+
+func TestDetected(t *testing.T) {
+	defer setEnvs(map[string]string{
+		"CI":             "true",
+		"CI_SYSTEM_NAME": "woodpecker",
+	})()
+	if detected("CI=woodpecker") {
+		t.Error("expected Woodpecker to require CI=woodpecker")
+	}
+	if !detected("CI") || !detected("CI_SYSTEM_NAME") {
+		t.Error("expected the variables to be detected")
+	}
+
+	os.Setenv("CI", "woodpecker")
+	if !detected("CI=woodpecker") {
+		t.Error("expected Woodpecker to be detected by CI=woodpecker")
+	}
+}
+
+func TestShadowedProviders(t *testing.T) {
+	defer unsetProviders()()
+	defer setEnvs(map[string]string{
+		"DRONE":            "true",
+		"HARNESS_BUILD_ID": "17",
+	})()
+
+	diag := newDiagnostics()
+	tags := getProviderTags(diag)
+	if tags[constants.CIProviderName] != "harness" {
+		t.Errorf("expected Harness, got %q", tags[constants.CIProviderName])
+	}
+	if hasWarning(diag, "several CI providers") {
+		t.Errorf("unexpected warnings %v", diag.Warnings)
+	}
+}
@@ -0,0 +1,174 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+)
+
+// ProviderConfigEnv is the environment variable holding the path of the configuration of a custom
+// CI provider, loaded before the providers are detected.
+const ProviderConfigEnv = "DD_CIVISIBILITY_CI_PROVIDER_CONFIG"
+
+var (
+	// customProvidersMu guards customProviders.
+	customProvidersMu sync.RWMutex
+	// customProviders are the providers registered by the users, by the environment variable
+	// detecting them. They take precedence over the built-in providers.
+	customProviders = map[string]providerType{}
+
+	providerConfigOnce sync.Once
+)
+
+// RegisterProvider registers the extractor of the tags of a custom CI provider, detected when the
+// environment variable key is set. The tags are normalized and overridden by the DD_GIT_* variables
+// like the ones of the built-in providers.
+func RegisterProvider(key string, extract func() map[string]string) {
+	customProvidersMu.Lock()
+	defer customProvidersMu.Unlock()
+	customProviders[key] = extract
+}
+
+// ProviderConfig is the declarative configuration of a custom CI provider, e.g.
+//
+//	detect: MY_CI
+//	name: my-ci
+//	tags:
+//	  ci.pipeline.id: MY_CI_RUN_ID
+//	  ci.pipeline.url: MY_CI_RUN_URL
+type ProviderConfig struct {
+	// Detect is the environment variable detecting the provider.
+	Detect string
+	// Name is the ci.provider.name tag, custom by default.
+	Name string
+	// Tags are the environment variables holding the value of each tag.
+	Tags map[string]string
+}
+
+// LoadProviderConfig registers the custom CI provider configured in the YAML file at path.
+func LoadProviderConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	cfg, err := ParseProviderConfig(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	RegisterProvider(cfg.Detect, cfg.extract)
+	return nil
+}
+
+// loadProviderConfigFromEnv registers the custom CI provider configured by ProviderConfigEnv, once.
+func loadProviderConfigFromEnv(diag *Diagnostics) {
+	providerConfigOnce.Do(func() {
+		if path := os.Getenv(ProviderConfigEnv); path != "" {
+			if err := LoadProviderConfig(path); err != nil {
+				diag.addError("cannot load the CI provider configuration: %v", err)
+			}
+		}
+	})
+}
+
+func (cfg *ProviderConfig) extract() map[string]string {
+	tags := map[string]string{}
+	for tag, key := range cfg.Tags {
+		tags[tag] = os.Getenv(key)
+	}
+	tags[constants.CIProviderName] = cfg.Name
+	return tags
+}
+
+// ParseProviderConfig parses the configuration of a custom CI provider. It supports the subset of
+// YAML needed by the configuration: a mapping of scalars, with the tags in a nested mapping.
+func ParseProviderConfig(data []byte) (*ProviderConfig, error) {
+	cfg := &ProviderConfig{Name: "custom", Tags: map[string]string{}}
+	inTags := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		indented := line[0] == ' ' || line[0] == '\t'
+		kv := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("line %d: expected a key: value pair", n)
+		}
+		key := strings.TrimSpace(kv[0])
+		value, err := parseScalar(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+
+		if indented {
+			if !inTags {
+				return nil, fmt.Errorf("line %d: unexpected indentation", n)
+			}
+			if value == "" {
+				return nil, fmt.Errorf("line %d: missing the environment variable of %s", n, key)
+			}
+			cfg.Tags[key] = value
+			continue
+		}
+		inTags = false
+		switch key {
+		case "detect":
+			cfg.Detect = value
+		case "name":
+			cfg.Name = value
+		case "tags":
+			if value != "" {
+				return nil, fmt.Errorf("line %d: expected a mapping of the tags", n)
+			}
+			inTags = true
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %s", n, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if cfg.Detect == "" {
+		return nil, fmt.Errorf("missing the detect environment variable")
+	}
+	return cfg, nil
+}
+
+// parseScalar returns the value of a plain or quoted YAML scalar, without its comment.
+func parseScalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := strings.LastIndex(s, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		end := strings.LastIndex(s, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.Replace(s[1:end], "''", "'", -1), nil
+	}
+	if strings.HasPrefix(s, "#") {
+		return "", nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
@@ -0,0 +1,151 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Define the sources of the CI tags.
+const (
+	// SourceProvider is the environment variables of the CI provider.
+	SourceProvider = "provider"
+
+	// SourceOverride is the DD_GIT_* environment variables set by the user.
+	SourceOverride = "override"
+
+	// SourceEnv is the environment the tests run in, e.g. the OS.
+	SourceEnv = "env"
+
+	// SourceLocalGit is the local git repository.
+	SourceLocalGit = "git"
+)
+
+// Diagnostics records how the CI tags were detected, to explain the missing or unexpected tags.
+type Diagnostics struct {
+	// Provider is the name of the CI provider detected, if any.
+	Provider string `json:"provider,omitempty"`
+	// Sources are the sources of the tags, e.g. SourceProvider.
+	Sources map[string]string `json:"sources,omitempty"`
+	// Errors are the errors that prevented the detection of tags.
+	Errors []string `json:"errors,omitempty"`
+	// Warnings report the required tags that are missing.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func newDiagnostics() *Diagnostics {
+	return &Diagnostics{Sources: map[string]string{}}
+}
+
+func (d *Diagnostics) addError(format string, args ...interface{}) {
+	d.Errors = append(d.Errors, fmt.Sprintf(format, args...))
+}
+
+func (d *Diagnostics) addWarning(format string, args ...interface{}) {
+	d.Warnings = append(d.Warnings, fmt.Sprintf(format, args...))
+}
+
+// track records source as the source of the tags whose value changed since before.
+func (d *Diagnostics) track(before, after map[string]string, source string) {
+	for key, value := range after {
+		if value != "" && before[key] != value {
+			d.Sources[key] = source
+		}
+	}
+}
+
+// missingTagWarning prefixes the warnings about the required tags missing.
+const missingTagWarning = "missing required tag "
+
+// check warns about the required tags of the bundled spec missing from tags, and forgets the
+// sources of the tags that were eventually removed.
+func (d *Diagnostics) check(tags map[string]string) {
+	d.checkRequired(tags, SpecTags)
+	for key := range d.Sources {
+		if tags[key] == "" {
+			delete(d.Sources, key)
+		}
+	}
+}
+
+// CheckSpec replaces the warnings about the required tags missing from tags with the ones of spec,
+// e.g. a ci-app-spec.json file other than the bundled one.
+func (d *Diagnostics) CheckSpec(tags map[string]string, spec []string) {
+	var warnings []string
+	for _, warning := range d.Warnings {
+		if !strings.HasPrefix(warning, missingTagWarning) {
+			warnings = append(warnings, warning)
+		}
+	}
+	d.Warnings = warnings
+	d.checkRequired(tags, spec)
+}
+
+func (d *Diagnostics) checkRequired(tags map[string]string, spec []string) {
+	for _, key := range RequiredTags(spec, d.Provider != "") {
+		if tags[key] == "" {
+			d.addWarning("%s%s", missingTagWarning, key)
+		}
+	}
+}
+
+// String returns the diagnostics encoded as JSON, as in the _dd.ci.diagnostics tag.
+func (d *Diagnostics) String() string {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// Log writes the diagnostics to the standard logger, one line per fact.
+func (d *Diagnostics) Log() {
+	if d.Provider != "" {
+		log.Printf("dd-sdk-go-testing: DEBUG: CI provider detected: %s", d.Provider)
+	} else {
+		log.Print("dd-sdk-go-testing: DEBUG: no CI provider detected")
+	}
+	keys := make([]string, 0, len(d.Sources))
+	for key := range d.Sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	bySource := map[string][]string{}
+	for _, key := range keys {
+		bySource[d.Sources[key]] = append(bySource[d.Sources[key]], key)
+	}
+	for _, source := range []string{SourceProvider, SourceOverride, SourceEnv, SourceLocalGit} {
+		if len(bySource[source]) > 0 {
+			log.Printf("dd-sdk-go-testing: DEBUG: tags from %s: %s", source, strings.Join(bySource[source], ", "))
+		}
+	}
+	for _, err := range d.Errors {
+		log.Printf("dd-sdk-go-testing: DEBUG: error: %s", err)
+	}
+	for _, warning := range d.Warnings {
+		log.Printf("dd-sdk-go-testing: DEBUG: warning: %s", warning)
+	}
+}
+
+// DebugEnabled reports whether the debug logs are enabled with DD_TRACE_DEBUG.
+func DebugEnabled() bool {
+	debug, _ := strconv.ParseBool(os.Getenv("DD_TRACE_DEBUG"))
+	return debug
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	c := make(map[string]string, len(tags))
+	for key, value := range tags {
+		c[key] = value
+	}
+	return c
+}
@@ -0,0 +1,155 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/testutil"
+)
+
+// unsetProviders unsets the environment variables detecting the CI providers, e.g. when running in CI.
+func unsetProviders() func() {
+	env := map[string]string{}
+	for key := range providers {
+		key, _ := providerEnv(key)
+		if value, ok := os.LookupEnv(key); ok {
+			env[key] = value
+			os.Unsetenv(key)
+		}
+	}
+	return func() {
+		for key, value := range env {
+			os.Setenv(key, value)
+		}
+	}
+}
+
+func hasWarning(diag *Diagnostics, prefix string) bool {
+	for _, warning := range diag.Warnings {
+		if strings.HasPrefix(warning, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDiagnostics(t *testing.T) {
+	defer unsetProviders()()
+
+	t.Run("provider", func(t *testing.T) {
+		defer setEnvs(map[string]string{
+			"GITLAB_CI":          "true",
+			"CI_PIPELINE_ID":     "",
+			"CI_COMMIT_REF_NAME": "main",
+			"CI_COMMIT_AUTHOR":   "Jane Doe <jane@example.com>",
+			"TRAVIS":             "true",
+			"DD_GIT_BRANCH":      "override",
+		})()
+		diag := newDiagnostics()
+		tags := getProviderTags(diag)
+		diag.check(tags)
+
+		if diag.Provider == "" || diag.Provider != tags[constants.CIProviderName] {
+			t.Fatalf("expected the provider %q, got %q", tags[constants.CIProviderName], diag.Provider)
+		}
+		if source := diag.Sources[constants.CIProviderName]; source != SourceProvider {
+			t.Errorf("expected the provider name from %s, got %q", SourceProvider, source)
+		}
+		if source := diag.Sources[constants.GitBranch]; source != SourceOverride {
+			t.Errorf("expected the branch from %s, got %q", SourceOverride, source)
+		}
+		if !hasWarning(diag, "several CI providers detected by GITLAB_CI, TRAVIS") {
+			t.Errorf("expected a warning about several providers, got %v", diag.Warnings)
+		}
+		if !hasWarning(diag, "missing required tag "+constants.CIPipelineID) {
+			t.Errorf("expected a warning about the pipeline ID, got %v", diag.Warnings)
+		}
+	})
+
+	t.Run("local", func(t *testing.T) {
+		dir, cleanup := testutil.NewRepository(t, 5)
+		defer cleanup()
+		defer testutil.Chdir(t, dir)()
+
+		tags, diag := GetCITagsWithDiagnostics()
+		if diag.Provider != "" {
+			t.Fatalf("expected no provider, got %q", diag.Provider)
+		}
+		for key, expected := range map[string]string{
+			constants.GitCommitSHA: SourceLocalGit,
+			constants.GitBranch:    SourceLocalGit,
+			constants.OSPlatform:   SourceEnv,
+			constants.RuntimeName:  SourceEnv,
+		} {
+			if source := diag.Sources[key]; source != expected {
+				t.Errorf("expected %s from %s, got %q", key, expected, source)
+			}
+		}
+		for key := range diag.Sources {
+			if tags[key] == "" {
+				t.Errorf("unexpected source of the missing tag %s", key)
+			}
+		}
+		if hasWarning(diag, "missing required tag") {
+			t.Errorf("unexpected warnings %v", diag.Warnings)
+		}
+
+		var decoded Diagnostics
+		if err := json.Unmarshal([]byte(diag.String()), &decoded); err != nil || decoded.Sources[constants.GitCommitSHA] != SourceLocalGit {
+			t.Fatalf("expected the sources in %s", diag.String())
+		}
+	})
+}
+
+// TestRequiredTags asserts that the required tags are tags of the spec, and that SpecTags is the spec.
+func TestRequiredTags(t *testing.T) {
+	data, err := ioutil.ReadFile("../../ci-app-spec.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec []string
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(SpecTags, spec) {
+		t.Errorf("SpecTags %v differs from ci-app-spec.json %v", SpecTags, spec)
+	}
+	if unknown := NotInSpec(map[string]string{constants.GitBranch: "main", constants.CINodeName: "runner"}, spec); !reflect.DeepEqual(unknown, []string{constants.CINodeName}) {
+		t.Errorf("expected %s not in the spec, got %v", constants.CINodeName, unknown)
+	}
+	required := map[string]string{}
+	for _, tag := range append(append([]string{}, requiredTags...), requiredProviderTags...) {
+		required[tag] = "value"
+	}
+	if unknown := NotInSpec(required, SpecTags); len(unknown) > 0 {
+		t.Errorf("required tags %v are not in the spec", unknown)
+	}
+	if expected := []string{constants.GitRepositoryURL, constants.CIProviderName}; !reflect.DeepEqual(RequiredTags(append(expected, constants.GitBranch), true), expected) {
+		t.Errorf("expected the required tags %v of the spec, got %v", expected, RequiredTags(expected, true))
+	}
+}
+
+func TestCheckSpec(t *testing.T) {
+	d := newDiagnostics()
+	d.addWarning("several CI providers detected")
+	tags := map[string]string{constants.GitCommitSHA: "abc"}
+	d.check(tags)
+	if len(d.Warnings) != len(requiredTags) {
+		t.Fatalf("expected the warnings about the missing required tags, got %v", d.Warnings)
+	}
+
+	d.CheckSpec(tags, []string{constants.GitCommitSHA, constants.OSPlatform, constants.CIProviderName})
+	if expected := []string{"several CI providers detected", "missing required tag os.platform"}; !reflect.DeepEqual(d.Warnings, expected) {
+		t.Errorf("expected the warnings %v, got %v", expected, d.Warnings)
+	}
+}
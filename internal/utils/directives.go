@@ -0,0 +1,94 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Define the directives of the commit messages.
+const (
+	// DirectiveSkipGitUpload disables the upload of the git metadata, as DD_CIVISIBILITY_GIT_UPLOAD_ENABLED=false
+	// does. The tests are still run and reported.
+	DirectiveSkipGitUpload = "skip-git-upload"
+
+	// DirectiveNoDeliveryRetries disables the spool keeping the payloads that couldn't be delivered
+	// for the retries, so they are lost on the first failure. The tests themselves are not retried.
+	DirectiveNoDeliveryRetries = "no-delivery-retries"
+
+	// DirectiveSkipITR and DirectiveNoRetries are the aliases of DirectiveSkipGitUpload and
+	// DirectiveNoDeliveryRetries.
+	DirectiveSkipITR   = "skip-itr"
+	DirectiveNoRetries = "no-retries"
+
+	// DirectiveTags adds custom tags to the spans, e.g. [dd tags: team=backend, tier=1].
+	DirectiveTags = "tags"
+)
+
+// directiveRegexp matches the directives of a commit message, e.g. [dd skip-git-upload] or [dd tags: k=v].
+var directiveRegexp = regexp.MustCompile(`(?i)\[dd\s+([a-z][a-z0-9-]*)\s*(?::([^\]]*))?\]`)
+
+// Directives are the instructions to the SDK found in a commit message, to control a single run
+// without changing the configuration of the CI.
+type Directives struct {
+	SkipGitUpload     bool
+	NoDeliveryRetries bool
+	// Tags are the custom tags of the tags directives.
+	Tags map[string]string
+	// Names are the names of the directives found, in order, e.g. DirectiveSkipGitUpload. The aliases
+	// are named after the directive they stand for.
+	Names []string
+}
+
+// ParseDirectives returns the directives of the commit message. The unknown directives are ignored.
+func ParseDirectives(message string) Directives {
+	d := Directives{Tags: map[string]string{}}
+	for _, match := range directiveRegexp.FindAllStringSubmatch(message, -1) {
+		name := strings.ToLower(match[1])
+		switch name {
+		case DirectiveSkipGitUpload, DirectiveSkipITR:
+			d.SkipGitUpload = true
+			name = DirectiveSkipGitUpload
+		case DirectiveNoDeliveryRetries, DirectiveNoRetries:
+			d.NoDeliveryRetries = true
+			name = DirectiveNoDeliveryRetries
+		case DirectiveTags:
+			for _, tag := range strings.Split(match[2], ",") {
+				kv := strings.SplitN(tag, "=", 2)
+				if key := strings.TrimSpace(kv[0]); key != "" && len(kv) == 2 {
+					d.Tags[key] = strings.TrimSpace(kv[1])
+				}
+			}
+		default:
+			if DebugEnabled() {
+				log.Printf("dd-sdk-go-testing: DEBUG: unknown commit message directive %q", match[0])
+			}
+			continue
+		}
+		d.add(name)
+	}
+	return d
+}
+
+func (d *Directives) add(name string) {
+	for _, n := range d.Names {
+		if n == name {
+			return
+		}
+	}
+	d.Names = append(d.Names, name)
+}
+
+// ApplyTags adds the custom tags to tags, without replacing the tags already detected.
+func (d Directives) ApplyTags(tags map[string]string) {
+	for key, value := range d.Tags {
+		if _, ok := tags[key]; !ok {
+			tags[key] = value
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDirectives(t *testing.T) {
+	d := ParseDirectives(`Fix the flaky test [DD no-delivery-retries]
+
+[dd tags: team = backend, tier=1, invalid] [dd unknown] [dd skip-git-upload] [dd tags: owner=jane]
+[dd no-delivery-retries]`)
+	if !d.SkipGitUpload || !d.NoDeliveryRetries {
+		t.Errorf("expected skip-git-upload and no-delivery-retries, got %+v", d)
+	}
+	if expected := []string{"no-delivery-retries", "tags", "skip-git-upload"}; !reflect.DeepEqual(d.Names, expected) {
+		t.Errorf("expected the directives %v, got %v", expected, d.Names)
+	}
+	if expected := map[string]string{"team": "backend", "tier": "1", "owner": "jane"}; !reflect.DeepEqual(d.Tags, expected) {
+		t.Errorf("expected the tags %v, got %v", expected, d.Tags)
+	}
+
+	tags := map[string]string{"team": "frontend"}
+	d.ApplyTags(tags)
+	if tags["team"] != "frontend" || tags["owner"] != "jane" {
+		t.Errorf("expected the custom tags without replacing the existing ones, got %v", tags)
+	}
+
+	for _, msg := range []string{"[dd skip-git-upload]", "[dd skip-itr]", "[DD Skip-ITR]"} {
+		if d := ParseDirectives(msg); !d.SkipGitUpload || d.NoDeliveryRetries || !reflect.DeepEqual(d.Names, []string{DirectiveSkipGitUpload}) {
+			t.Errorf("%s: expected skip-git-upload, got %+v", msg, d)
+		}
+	}
+	for _, msg := range []string{"[dd no-delivery-retries]", "[dd no-retries]", "[dd no-retries] [dd no-delivery-retries]"} {
+		if d := ParseDirectives(msg); !d.NoDeliveryRetries || d.SkipGitUpload || !reflect.DeepEqual(d.Names, []string{DirectiveNoDeliveryRetries}) {
+			t.Errorf("%s: expected no-delivery-retries, got %+v", msg, d)
+		}
+	}
+
+	if d := ParseDirectives("Skip the tests [skip ci] [dd]"); d.SkipGitUpload || d.NoDeliveryRetries || len(d.Names) != 0 || len(d.Tags) != 0 {
+		t.Errorf("expected no directives, got %+v", d)
+	}
+}
@@ -6,6 +6,13 @@
 package utils
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -16,6 +23,7 @@ type LocalGitData struct {
 	SourceRoot     string
 	RepositoryUrl  string
 	Branch         string
+	Tag            string
 	CommitSha      string
 	AuthorDate     time.Time
 	AuthorName     string
@@ -24,35 +32,189 @@ type LocalGitData struct {
 	CommitterName  string
 	CommitterEmail string
 	CommitMessage  string
+
+	// SubmoduleRepositoryUrl and SubmoduleCommitSha describe the submodule of the working directory,
+	// when the other fields describe its superproject.
+	SubmoduleRepositoryUrl string
+	SubmoduleCommitSha     string
+}
+
+// defaultRemotePriority is the order in which the remotes are chosen, before the first remote.
+const defaultRemotePriority = "upstream,origin"
+
+// chooseRemote returns the first remote of DD_CIVISIBILITY_GIT_REMOTE_PRIORITY, a comma-separated
+// list of remote names, among the given ones, or else the first of them.
+func chooseRemote(remotes []string) string {
+	if len(remotes) == 0 {
+		return ""
+	}
+	priority := os.Getenv("DD_CIVISIBILITY_GIT_REMOTE_PRIORITY")
+	if priority == "" {
+		priority = defaultRemotePriority
+	}
+	for _, name := range strings.Split(priority, ",") {
+		for _, remote := range remotes {
+			if remote == strings.TrimSpace(name) {
+				return remote
+			}
+		}
+	}
+	return remotes[0]
 }
 
-// LocalGetGitData get the git data from the HEAD in Git repository
+// LocalGetGitData get the git data from the HEAD in Git repository. The repository is read directly,
+// so that it works without the git binary, which is only used as a fallback for the repositories
+// that can't be read.
 func LocalGetGitData() (LocalGitData, error) {
+	gitData, err := readLocalGitData()
+	if err != nil {
+		if execData, execErr := execGetGitData(); execErr == nil {
+			return execData, nil
+		}
+	}
+	return gitData, err
+}
+
+// readLocalGitData reads the git data of the repository of the working directory, or of its
+// superproject if it is a submodule.
+func readLocalGitData() (LocalGitData, error) {
+	repo, err := openGitRepository()
+	if err != nil {
+		return LocalGitData{}, err
+	}
+	gitData, err := readGitData(repo)
+	if err != nil {
+		return gitData, err
+	}
+	if super := repo.superproject(); super != nil {
+		if superData, err := readGitData(super); err == nil {
+			superData.SubmoduleRepositoryUrl = gitData.RepositoryUrl
+			superData.SubmoduleCommitSha = gitData.CommitSha
+			return superData, nil
+		}
+	}
+	return gitData, nil
+}
+
+// readGitData reads the git data of the HEAD of repo.
+func readGitData(repo *gitRepository) (LocalGitData, error) {
+	gitData := LocalGitData{}
+	gitData.SourceRoot = repo.workTree
+	gitData.RepositoryUrl = repo.remoteURL()
+
+	ref, sha, err := repo.head()
+	if err != nil {
+		return gitData, err
+	}
+	if strings.HasPrefix(ref, "refs/heads/") {
+		gitData.Branch = strings.TrimPrefix(ref, "refs/heads/")
+	} else {
+		// Detached HEAD, e.g. a CI checking out the commit to test.
+		gitData.Branch = repo.remoteBranchContaining(sha)
+	}
+	if tags := repo.tagsPointingAt(sha); len(tags) > 0 {
+		gitData.Tag = tags[0]
+	}
+
+	commit, err := repo.readCommit(sha)
+	if err != nil {
+		return gitData, err
+	}
+	gitData.CommitSha = sha
+	gitData.AuthorDate = commit.author.date
+	gitData.AuthorName = commit.author.name
+	gitData.AuthorEmail = commit.author.email
+	gitData.CommitterDate = commit.committer.date
+	gitData.CommitterName = commit.committer.name
+	gitData.CommitterEmail = commit.committer.email
+	gitData.CommitMessage = strings.Trim(commit.message, "\n")
+
+	return gitData, nil
+}
+
+// execGetGitData get the git data from the HEAD in Git repository with the git binary, or from the
+// HEAD of its superproject if it is a submodule.
+func execGetGitData() (LocalGitData, error) {
+	gitData, err := execGetRepositoryData("")
+	if err != nil {
+		return gitData, err
+	}
+	if super := execSuperproject(); super != "" {
+		if superData, err := execGetRepositoryData(super); err == nil {
+			superData.SubmoduleRepositoryUrl = gitData.RepositoryUrl
+			superData.SubmoduleCommitSha = gitData.CommitSha
+			return superData, nil
+		}
+	}
+	return gitData, nil
+}
+
+// execSuperproject returns the worktree of the outermost superproject of the working directory, or
+// an empty string if it isn't in a submodule.
+func execSuperproject() string {
+	super := ""
+	for {
+		out, err := gitOutput(super, "rev-parse", "--show-superproject-working-tree")
+		dir := strings.Trim(string(out), "\n")
+		if err != nil || dir == "" {
+			return super
+		}
+		super = dir
+	}
+}
+
+// gitOutput runs a git command in dir, or in the working directory if empty, and returns its output.
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	return cmd.Output()
+}
+
+// execGetRepositoryData get the git data from the HEAD of the repository of dir with the git binary.
+func execGetRepositoryData(dir string) (LocalGitData, error) {
 	gitData := LocalGitData{}
 
 	// Extract git working folder
-	out, err := exec.Command("git", "rev-parse", "--absolute-git-dir").Output()
+	out, err := gitOutput(dir, "rev-parse", "--show-toplevel")
 	if err != nil {
 		return gitData, err
 	}
-	gitData.SourceRoot = strings.ReplaceAll(strings.Trim(string(out), "\n"), ".git", "")
+	gitData.SourceRoot = strings.Trim(string(out), "\n")
 
 	// Extract repository data
-	out, err = exec.Command("git", "ls-remote", "--get-url").Output()
+	out, err = gitOutput(dir, "remote")
 	if err != nil {
 		return gitData, err
 	}
-	gitData.RepositoryUrl = strings.Trim(string(out), "\n")
+	if remote := chooseRemote(strings.Fields(string(out))); remote != "" {
+		out, err = gitOutput(dir, "remote", "get-url", remote)
+		if err != nil {
+			return gitData, err
+		}
+		gitData.RepositoryUrl = strings.Trim(string(out), "\n")
+	}
 
 	// Extract the branch name
-	out, err = exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
+	out, err = gitOutput(dir, "rev-parse", "--abbrev-ref", "HEAD")
 	if err != nil {
 		return gitData, err
 	}
 	gitData.Branch = strings.Trim(string(out), "\n")
+	if gitData.Branch == "HEAD" {
+		// Detached HEAD, e.g. a CI checking out the commit to test.
+		gitData.Branch = execRemoteBranchContaining(dir)
+	}
+
+	out, err = gitOutput(dir, "tag", "--points-at", "HEAD")
+	if err != nil {
+		return gitData, err
+	}
+	if tags := strings.Fields(string(out)); len(tags) > 0 {
+		gitData.Tag = tags[0]
+	}
 
 	// Get remaining data from the git log command: git log -1 --pretty='%H","%aI","%an","%ae","%cI","%cn","%ce","%B'
-	out, err = exec.Command("git", "log", "-1", "--pretty=%H\",\"%at\",\"%an\",\"%ae\",\"%ct\",\"%cn\",\"%ce\",\"%B").Output()
+	out, err = gitOutput(dir, "log", "-1", "--pretty=%H\",\"%at\",\"%an\",\"%ae\",\"%ct\",\"%cn\",\"%ce\",\"%B")
 	if err != nil {
 		return gitData, err
 	}
@@ -71,3 +233,160 @@ func LocalGetGitData() (LocalGitData, error) {
 
 	return gitData, nil
 }
+
+// execRemoteBranchContaining returns the first remote branch pointing at HEAD, or else containing it,
+// without the name of its remote.
+func execRemoteBranchContaining(dir string) string {
+	var remotes []string
+	if out, err := gitOutput(dir, "remote"); err == nil {
+		remotes = strings.Fields(string(out))
+	}
+	for _, filter := range []string{"--points-at", "--contains"} {
+		out, err := gitOutput(dir, "branch", "-r", filter, "HEAD", "--format=%(refname:short)")
+		if err != nil {
+			return ""
+		}
+		for _, branch := range strings.Fields(string(out)) {
+			if !strings.HasSuffix(branch, "/HEAD") {
+				return trimRemote(branch, remotes)
+			}
+		}
+	}
+	return ""
+}
+
+// openLocalGitRepository opens the repository described by LocalGetGitData: the repository of the
+// working directory, or its superproject if it is a submodule.
+func openLocalGitRepository() (*gitRepository, error) {
+	repo, err := openGitRepository()
+	if err != nil {
+		return nil, err
+	}
+	if super := repo.superproject(); super != nil {
+		return super, nil
+	}
+	return repo, nil
+}
+
+// LocalGitRoot returns the worktree of the repository described by LocalGetGitData, or an empty
+// string outside of a repository.
+func LocalGitRoot() string {
+	if repo, err := openLocalGitRepository(); err == nil {
+		return repo.workTree
+	}
+	if super := execSuperproject(); super != "" {
+		return super
+	}
+	out, err := gitOutput("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(string(out), "\n")
+}
+
+// IsShallowClone reports whether the repository described by LocalGetGitData is a shallow clone,
+// e.g. cloned with --depth=1.
+func IsShallowClone() bool {
+	if repo, err := openLocalGitRepository(); err == nil {
+		return repo.isShallow()
+	}
+	out, err := gitOutput(execSuperproject(), "rev-parse", "--is-shallow-repository")
+	return err == nil && strings.Trim(string(out), "\n") == "true"
+}
+
+// Unshallow fetches the history of the last month of the shallow clone described by LocalGetGitData,
+// without the file contents. The commit checked out is fetched from the remote of the branch, or
+// the remote chosen by priority, falling back to its upstream branch and to the default branch of
+// the remote.
+func Unshallow(ctx context.Context) error {
+	repo, err := openLocalGitRepository()
+	if err != nil {
+		return err
+	}
+	ref, sha, err := repo.head()
+	if err != nil {
+		return err
+	}
+	branch := strings.TrimPrefix(ref, "refs/heads/")
+	cfg := repo.config()
+	remote := cfg.get("branch." + branch + ".remote")
+	if remote == "" || remote == "." {
+		remote = chooseRemote(repo.remotes())
+	}
+	if remote == "" {
+		return errors.New("no remote to fetch from")
+	}
+
+	refspecs := [][]string{{remote, sha}}
+	if merge := cfg.get("branch." + branch + ".merge"); merge != "" {
+		refspecs = append(refspecs, []string{remote, merge})
+	}
+	refspecs = append(refspecs, []string{remote})
+	for _, refspec := range refspecs {
+		args := append([]string{"fetch", "--shallow-since=1 month ago", "--update-shallow", "--filter=blob:none", "--recurse-submodules=no"}, refspec...)
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = repo.workTree
+		var out []byte
+		out, err = cmd.CombinedOutput()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			return nil
+		}
+		err = fmt.Errorf("git fetch: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return err
+}
+
+// GitStatus describes the uncommitted changes of a worktree.
+type GitStatus struct {
+	ModifiedFiles  int
+	UntrackedFiles int
+	// DiffSHA is the SHA-256 hash of the changes of the tracked files, if requested.
+	DiffSHA string
+}
+
+// Dirty reports whether the worktree has uncommitted changes.
+func (s GitStatus) Dirty() bool {
+	return s.ModifiedFiles > 0 || s.UntrackedFiles > 0
+}
+
+// LocalGetGitStatus returns the uncommitted changes of the worktree described by LocalGetGitData,
+// and the hash of the changes of the tracked files if diffHash is set. It requires the git binary.
+func LocalGetGitStatus(diffHash bool) (GitStatus, error) {
+	status := GitStatus{}
+	dir := LocalGitRoot()
+	out, err := gitOutput(dir, "status", "--porcelain", "-z", "--untracked-files=all")
+	if err != nil {
+		return status, err
+	}
+	// The entries are "XY path", followed by the original path for renames and copies.
+	entries := strings.Split(string(out), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		switch xy := entry[:2]; {
+		case xy == "??":
+			status.UntrackedFiles++
+		case xy == "!!":
+		default:
+			status.ModifiedFiles++
+			if xy[0] == 'R' || xy[0] == 'C' {
+				i++
+			}
+		}
+	}
+
+	if diffHash && status.ModifiedFiles > 0 {
+		out, err := gitOutput(dir, "diff", "HEAD", "--binary", "--no-color", "--no-ext-diff")
+		if err != nil {
+			return status, err
+		}
+		sum := sha256.Sum256(out)
+		status.DiffSHA = hex.EncodeToString(sum[:])
+	}
+	return status, nil
+}
@@ -0,0 +1,301 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/testutil"
+)
+
+// assertSameGitData asserts that reading the repository of dir gives the same data as the git binary.
+func assertSameGitData(t *testing.T, dir string) {
+	defer testutil.Chdir(t, dir)()
+	expected, err := execGetGitData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := readLocalGitData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func assertLocalGitData(t *testing.T, dir, branch, tag string) {
+	defer testutil.Chdir(t, dir)()
+	data, err := readLocalGitData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Branch != branch || data.Tag != tag {
+		t.Fatalf("expected the branch %q and the tag %q, got %q and %q", branch, tag, data.Branch, data.Tag)
+	}
+}
+
+// assertSameObjects asserts that all the objects of the repository of dir are read as with git cat-file.
+func assertSameObjects(t *testing.T, dir string) {
+	defer testutil.Chdir(t, dir)()
+	repo, err := openGitRepository()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(testutil.Git(t, dir, "rev-list", "--objects", "--all")), "\n") {
+		sha := strings.Fields(line)[0]
+		objType, data, err := repo.readObject(sha)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedType := strings.TrimSpace(testutil.Git(t, dir, "cat-file", "-t", sha))
+		if gitObjectTypes[expectedType] != objType {
+			t.Fatalf("object %s: expected a %s, got %d", sha, expectedType, objType)
+		}
+		if expected := testutil.Git(t, dir, "cat-file", expectedType, sha); !bytes.Equal([]byte(expected), data) {
+			t.Fatalf("object %s: expected %q, got %q", sha, expected, data)
+		}
+	}
+}
+
+func TestReadLocalGitData(t *testing.T) {
+	dir, cleanup := testutil.NewRepository(t, 5)
+	defer cleanup()
+
+	t.Run("loose", func(t *testing.T) {
+		assertSameGitData(t, dir)
+		assertSameObjects(t, dir)
+	})
+
+	t.Run("packed", func(t *testing.T) {
+		testutil.Git(t, dir, "gc", "-q", "--aggressive")
+		if _, err := os.Stat(filepath.Join(dir, ".git", "packed-refs")); err != nil {
+			t.Fatal(err)
+		}
+		assertSameGitData(t, dir)
+		assertSameObjects(t, dir)
+	})
+
+	t.Run("ref-deltas", func(t *testing.T) {
+		testutil.Git(t, dir, "-c", "repack.useDeltaBaseOffset=false", "repack", "-q", "-a", "-d", "-f")
+		assertSameObjects(t, dir)
+	})
+
+	t.Run("subdirectory", func(t *testing.T) {
+		sub := filepath.Join(dir, "sub")
+		if err := os.Mkdir(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		assertSameGitData(t, sub)
+	})
+
+	t.Run("detached", func(t *testing.T) {
+		commits := strings.Fields(testutil.Git(t, dir, "log", "--format=%H"))
+		testutil.Git(t, dir, "checkout", "-q", commits[2])
+		defer testutil.Git(t, dir, "checkout", "-q", "feature/reader")
+		assertSameGitData(t, dir)
+
+		// The branch is the first remote branch pointing at the commit, or else containing it,
+		// without the name of its remote.
+		testutil.Git(t, dir, "remote", "add", "upstream/fork", "https://github.com/DataDog/fork.git")
+		defer testutil.Git(t, dir, "remote", "remove", "upstream/fork")
+		testutil.Git(t, dir, "update-ref", "refs/remotes/upstream/main", commits[0])
+		testutil.Git(t, dir, "update-ref", "refs/remotes/upstream/release", commits[1])
+		testutil.Git(t, dir, "symbolic-ref", "refs/remotes/upstream/HEAD", "refs/remotes/upstream/main")
+		assertSameGitData(t, dir)
+		assertLocalGitData(t, dir, "main", "")
+		testutil.Git(t, dir, "update-ref", "refs/remotes/upstream/fix", commits[2])
+		testutil.Git(t, dir, "pack-refs", "--all")
+		assertSameGitData(t, dir)
+		assertLocalGitData(t, dir, "fix", "")
+
+		// Tags, lightweight or annotated, are detected.
+		testutil.Git(t, dir, "tag", "v1.0.1", commits[2])
+		testutil.Git(t, dir, "tag", "-a", "-m", "Release", "v1.0.0", commits[2])
+		assertSameGitData(t, dir)
+		assertLocalGitData(t, dir, "fix", "v1.0.0")
+		testutil.Git(t, dir, "pack-refs", "--all")
+		assertSameGitData(t, dir)
+
+		// The name of a remote may hold a slash.
+		testutil.Git(t, dir, "update-ref", "refs/remotes/upstream/fork/hotfix", commits[2])
+		testutil.Git(t, dir, "update-ref", "-d", "refs/remotes/upstream/fix")
+		assertSameGitData(t, dir)
+		assertLocalGitData(t, dir, "hotfix", "v1.0.0")
+	})
+
+	t.Run("shallow", func(t *testing.T) {
+		clone := dir + "-clone"
+		testutil.Git(t, dir, "clone", "-q", "--depth=1", "file://"+dir, clone)
+		defer os.RemoveAll(clone)
+		assertSameGitData(t, clone)
+		defer testutil.Chdir(t, clone)()
+		if !IsShallowClone() {
+			t.Fatal("expected a shallow clone")
+		}
+	})
+
+	t.Run("worktree", func(t *testing.T) {
+		wt := dir + "-worktree"
+		testutil.Git(t, dir, "worktree", "add", "-q", "-b", "other", wt, "HEAD~2")
+		defer os.RemoveAll(wt)
+		testutil.Git(t, dir, "remote", "add", "origin", "https://github.com/DataDog/origin.git")
+		assertSameGitData(t, wt)
+	})
+}
+
+func TestReadLocalGitDataSubmodule(t *testing.T) {
+	dir, cleanup := testutil.NewRepository(t, 5)
+	defer cleanup()
+	lib, cleanupLib := testutil.NewRepository(t, 5)
+	defer cleanupLib()
+	testutil.Git(t, lib, "remote", "add", "origin", "https://github.com/DataDog/lib.git")
+
+	testutil.Git(t, dir, "-c", "protocol.file.allow=always", "submodule", "add", "-q", "file://"+lib, "deps/lib")
+	testutil.Git(t, dir, "commit", "-q", "-m", "Add the submodule")
+	sub := filepath.Join(dir, "deps", "lib")
+	testutil.Git(t, sub, "remote", "set-url", "origin", "https://github.com/DataDog/lib.git")
+	assertSameGitData(t, sub)
+
+	defer testutil.Chdir(t, sub)()
+	data, err := readLocalGitData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	superSha := strings.TrimSpace(testutil.Git(t, dir, "rev-parse", "HEAD"))
+	subSha := strings.TrimSpace(testutil.Git(t, sub, "rev-parse", "HEAD"))
+	if data.SourceRoot != dir || data.CommitSha != superSha || data.RepositoryUrl != "https://github.com/DataDog/upstream.git" {
+		t.Fatalf("expected the data of the superproject, got %+v", data)
+	}
+	if data.SubmoduleCommitSha != subSha || data.SubmoduleRepositoryUrl != "https://github.com/DataDog/lib.git" {
+		t.Fatalf("expected the submodule %s at %s, got %+v", "https://github.com/DataDog/lib.git", subSha, data)
+	}
+	if root := LocalGitRoot(); root != dir {
+		t.Fatalf("expected the root %s, got %s", dir, root)
+	}
+}
+
+func TestChooseRemote(t *testing.T) {
+	dir, cleanup := testutil.NewRepository(t, 5)
+	defer cleanup()
+	testutil.Git(t, dir, "remote", "add", "origin", "https://github.com/DataDog/origin.git")
+	testutil.Git(t, dir, "remote", "add", "fork", "https://github.com/jane/fork.git")
+
+	for _, tt := range []struct {
+		priority string
+		expected string
+	}{
+		{"", "https://github.com/DataDog/upstream.git"},
+		{"origin, upstream", "https://github.com/DataDog/origin.git"},
+		{"unknown", "https://github.com/jane/fork.git"},
+	} {
+		restore := setEnvs(map[string]string{"DD_CIVISIBILITY_GIT_REMOTE_PRIORITY": tt.priority})
+		assertSameGitData(t, dir)
+		func() {
+			defer testutil.Chdir(t, dir)()
+			data, err := readLocalGitData()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data.RepositoryUrl != tt.expected {
+				t.Errorf("priority %q: expected %s, got %s", tt.priority, tt.expected, data.RepositoryUrl)
+			}
+		}()
+		restore()
+	}
+}
+
+func TestLocalGetGitStatus(t *testing.T) {
+	dir, cleanup := testutil.NewRepository(t, 5)
+	defer cleanup()
+	defer testutil.Chdir(t, dir)()
+
+	status, err := LocalGetGitStatus(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Dirty() || status.DiffSHA != "" {
+		t.Fatalf("expected a clean worktree, got %+v", status)
+	}
+
+	// A modified file, a staged new file, a renamed file and 2 untracked files.
+	for path, content := range map[string]string{
+		"file.txt":    "modified",
+		"staged.txt":  "staged",
+		"renamed.txt": "renamed",
+		"new/one.txt": "untracked",
+		"new/two.txt": "untracked",
+	} {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testutil.Git(t, dir, "add", "staged.txt", "renamed.txt")
+	testutil.Git(t, dir, "commit", "-q", "-m", "Add renamed.txt", "renamed.txt")
+	testutil.Git(t, dir, "mv", "renamed.txt", "moved.txt")
+
+	status, err = LocalGetGitStatus(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ModifiedFiles != 3 || status.UntrackedFiles != 2 || len(status.DiffSHA) != 64 {
+		t.Fatalf("expected 3 modified and 2 untracked files with a diff hash, got %+v", status)
+	}
+
+	// The hash changes with the changes.
+	if err := ioutil.WriteFile("file.txt", []byte("modified again"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modified, err := LocalGetGitStatus(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modified.DiffSHA == status.DiffSHA {
+		t.Fatal("expected a different diff hash")
+	}
+	if status, _ := LocalGetGitStatus(false); status.DiffSHA != "" {
+		t.Fatalf("expected no diff hash, got %q", status.DiffSHA)
+	}
+}
+
+func TestGitConfig(t *testing.T) {
+	cfg := gitConfig{}
+	cfg.parse(`# comment
+[core]
+	bare = false
+	IgnoreCase
+[remote "Origin"]
+	url = "https://example.com/a b.git" ; comment
+	fetch = +refs/heads/*:refs/remotes/origin/*
+[Remote.legacy]
+	URL = git@example.com:legacy.git # comment
+[branch "main"] remote = Origin
+[alias]
+	co = "checkout \"main\"" \
+	  --quiet
+`)
+	for key, expected := range map[string]string{
+		"core.bare":          "false",
+		"core.ignorecase":    "true",
+		"remote.Origin.url":  "https://example.com/a b.git",
+		"REMOTE.Origin.URL":  "https://example.com/a b.git",
+		"remote.origin.url":  "",
+		"remote.legacy.url":  "git@example.com:legacy.git",
+		"branch.main.remote": "Origin",
+		"alias.co":           `checkout "main"    --quiet`,
+	} {
+		if actual := cfg.get(key); actual != expected {
+			t.Errorf("%s: expected %q, got %q", key, expected, actual)
+		}
+	}
+}
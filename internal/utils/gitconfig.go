@@ -0,0 +1,152 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"strings"
+)
+
+// gitConfig holds the values of a git configuration file by "section.subsection.key". As with
+// git, sections and keys are case-insensitive while subsections are case-sensitive.
+type gitConfig map[string][]string
+
+// get returns the last value of key, or an empty string if it isn't set.
+func (c gitConfig) get(key string) string {
+	values := c[normalizeConfigKey(key)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// getAll returns all the values of key, in the order they were set.
+func (c gitConfig) getAll(key string) []string {
+	return c[normalizeConfigKey(key)]
+}
+
+// add appends a value to key.
+func (c gitConfig) add(key, value string) {
+	key = normalizeConfigKey(key)
+	c[key] = append(c[key], value)
+}
+
+func normalizeConfigKey(key string) string {
+	first := strings.IndexByte(key, '.')
+	last := strings.LastIndexByte(key, '.')
+	if first < 0 {
+		return strings.ToLower(key)
+	}
+	return strings.ToLower(key[:first]) + key[first:last] + strings.ToLower(key[last:])
+}
+
+// parse reads the content of a configuration file. Includes are not followed.
+func (c gitConfig) parse(content string) {
+	var section string
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line != "" && line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end < 0 {
+				section = ""
+				continue
+			}
+			section = parseSectionHeader(line[1:end])
+			line = strings.TrimSpace(line[end+1:])
+		}
+		if line == "" || line[0] == '#' || line[0] == ';' || section == "" {
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			// A key without a value is a true boolean.
+			name := strings.TrimSpace(strings.FieldsFunc(line, isConfigComment)[0])
+			c.add(section+"."+name, "true")
+			continue
+		}
+		name := strings.TrimSpace(line[:eq])
+		raw := line[eq+1:]
+		// Values continue on the next line when they end with an unescaped backslash.
+		for endsWithEscape(raw) && i+1 < len(lines) {
+			i++
+			raw = raw[:len(raw)-1] + lines[i]
+		}
+		c.add(section+"."+name, parseConfigValue(raw))
+	}
+}
+
+func isConfigComment(r rune) bool {
+	return r == '#' || r == ';'
+}
+
+func endsWithEscape(s string) bool {
+	n := 0
+	for i := len(s) - 1; i >= 0 && s[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// parseSectionHeader parses `section "subsection"`, or the deprecated `section.subsection`.
+func parseSectionHeader(header string) string {
+	header = strings.TrimSpace(header)
+	quote := strings.IndexByte(header, '"')
+	if quote < 0 {
+		return strings.ToLower(header)
+	}
+	section := strings.ToLower(strings.TrimSpace(header[:quote]))
+	var sub strings.Builder
+	for i := quote + 1; i < len(header) && header[i] != '"'; i++ {
+		if header[i] == '\\' && i+1 < len(header) {
+			i++
+		}
+		sub.WriteByte(header[i])
+	}
+	return section + "." + sub.String()
+}
+
+// parseConfigValue unquotes a value and strips its comment and surrounding whitespace.
+func parseConfigValue(raw string) string {
+	var value strings.Builder
+	inQuote := false
+	// keep is the length of the value without the trailing unquoted whitespace.
+	keep := 0
+	for i := 0; i < len(raw); i++ {
+		ch := raw[i]
+		switch {
+		case ch == '"':
+			inQuote = !inQuote
+			keep = value.Len()
+			continue
+		case !inQuote && (ch == '#' || ch == ';'):
+			return value.String()[:keep]
+		case ch == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				ch = '\n'
+			case 't':
+				ch = '\t'
+			case 'b':
+				ch = '\b'
+			default:
+				ch = raw[i]
+			}
+			value.WriteByte(ch)
+			keep = value.Len()
+			continue
+		case !inQuote && (ch == ' ' || ch == '\t'):
+			if value.Len() > 0 {
+				value.WriteByte(' ')
+			}
+			continue
+		}
+		value.WriteByte(ch)
+		keep = value.Len()
+	}
+	return value.String()[:keep]
+}
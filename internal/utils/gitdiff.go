@@ -0,0 +1,127 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hunkRegexp matches the header of a hunk of a unified diff, capturing the first line and the number
+// of lines of the new file.
+var hunkRegexp = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// LineRange is a range of lines of a file, inclusive.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// GitDiff holds the lines changed in each file, by absolute path.
+type GitDiff map[string][]LineRange
+
+// Intersects reports whether the lines from start to end of the file at path changed. The whole
+// file is considered when start is 0.
+func (d GitDiff) Intersects(path string, start, end int) bool {
+	ranges, ok := d[filepath.Clean(path)]
+	if !ok {
+		return false
+	}
+	if start == 0 {
+		return true
+	}
+	for _, r := range ranges {
+		if r.Start <= end && start <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// LocalGetGitDiff returns the lines changed between the merge-base of HEAD and the base branch, and
+// HEAD, in the repository described by LocalGetGitData. The base branch is looked up on the remote
+// chosen by priority first. It requires the git binary.
+func LocalGetGitDiff(baseBranch string) (GitDiff, error) {
+	dir := LocalGitRoot()
+	if dir == "" {
+		return nil, fmt.Errorf("not a git repository")
+	}
+	base := ""
+	var candidates []string
+	if out, err := gitOutput(dir, "remote"); err == nil {
+		if remote := chooseRemote(strings.Fields(string(out))); remote != "" {
+			candidates = append(candidates, "refs/remotes/"+remote+"/"+baseBranch)
+		}
+	}
+	candidates = append(candidates, baseBranch)
+	for _, ref := range candidates {
+		if _, err := gitOutput(dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err == nil {
+			base = ref
+			break
+		}
+	}
+	if base == "" {
+		return nil, fmt.Errorf("unknown base branch %s", baseBranch)
+	}
+	out, err := gitOutput(dir, "merge-base", base, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the merge-base with %s: %v", base, err)
+	}
+	mergeBase := strings.TrimSpace(string(out))
+	out, err = gitOutput(dir, "-c", "core.quotePath=false", "diff", "--unified=0", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/", mergeBase, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return parseGitDiff(dir, out), nil
+}
+
+// parseGitDiff returns the lines of the new files changed by the unified diff, whose paths are
+// relative to dir.
+func parseGitDiff(dir string, diff []byte) GitDiff {
+	d := GitDiff{}
+	var path string
+	// header is set until the first hunk of a file, so that the added lines aren't taken for headers.
+	header := false
+	scanner := bufio.NewScanner(bytes.NewReader(diff))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			path, header = "", true
+		case header && strings.HasPrefix(line, "+++ "):
+			if name := strings.TrimPrefix(line, "+++ "); strings.HasPrefix(name, "b/") {
+				path = filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(name, "b/")))
+			}
+		case path != "" && strings.HasPrefix(line, "@@ "):
+			header = false
+			match := hunkRegexp.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			start, _ := strconv.Atoi(match[1])
+			count := 1
+			if match[2] != "" {
+				count, _ = strconv.Atoi(match[2])
+			}
+			// A deletion is located after its first line, which is kept as changed.
+			end := start + count - 1
+			if count == 0 {
+				if start == 0 {
+					start = 1
+				}
+				end = start
+			}
+			d[path] = append(d[path], LineRange{Start: start, End: end})
+		}
+	}
+	return d
+}
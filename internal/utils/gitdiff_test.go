@@ -0,0 +1,79 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/testutil"
+)
+
+func TestParseGitDiff(t *testing.T) {
+	d := parseGitDiff("/src", []byte(`diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -3 +3 @@ func A() {
+-	return 1
++	return 2
+@@ -10,0 +11,2 @@ func B() {
+++++ an added line looking like a header
++	b()
+@@ -20,2 +21,0 @@ func C() {
+-	c()
+-	c()
+diff --git a/removed.go b/removed.go
+deleted file mode 100644
+--- a/removed.go
++++ /dev/null
+@@ -1 +0,0 @@
+-package removed
+`))
+	expected := GitDiff{filepath.FromSlash("/src/a.go"): {{3, 3}, {11, 12}, {21, 21}}}
+	if !reflect.DeepEqual(d, expected) {
+		t.Fatalf("expected %v, got %v", expected, d)
+	}
+	for _, tt := range []struct {
+		start, end int
+		expected   bool
+	}{
+		{1, 2, false},
+		{1, 3, true},
+		{12, 20, true},
+		{13, 20, false},
+		{0, 0, true},
+	} {
+		if actual := d.Intersects(filepath.FromSlash("/src/a.go"), tt.start, tt.end); actual != tt.expected {
+			t.Errorf("lines %d-%d: expected %v, got %v", tt.start, tt.end, tt.expected, actual)
+		}
+	}
+	if d.Intersects(filepath.FromSlash("/src/b.go"), 0, 0) {
+		t.Error("expected b.go to be unchanged")
+	}
+}
+
+func TestLocalGetGitDiff(t *testing.T) {
+	dir, cleanup := testutil.NewRepository(t, 5)
+	defer cleanup()
+	defer testutil.Chdir(t, dir)()
+	testutil.Git(t, dir, "branch", "main", "HEAD~2")
+
+	// The 2 last commits added a line each after the 203 first lines.
+	d, err := LocalGetGitDiff("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "file.txt")
+	if !d.Intersects(file, 205, 210) || d.Intersects(file, 1, 203) {
+		t.Fatalf("expected the lines 204 and 205 to be changed, got %v", d)
+	}
+
+	if _, err := LocalGetGitDiff("unknown"); err == nil {
+		t.Fatal("expected an unknown base branch")
+	}
+}
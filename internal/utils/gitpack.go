@@ -0,0 +1,265 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Define the types of the git objects, as encoded in the pack files.
+const (
+	gitObjectCommit   = 1
+	gitObjectTree     = 2
+	gitObjectBlob     = 3
+	gitObjectTag      = 4
+	gitObjectOfsDelta = 6
+	gitObjectRefDelta = 7
+)
+
+var gitObjectTypes = map[string]int{
+	"commit": gitObjectCommit,
+	"tree":   gitObjectTree,
+	"blob":   gitObjectBlob,
+	"tag":    gitObjectTag,
+}
+
+// maxDeltaDepth bounds the length of the delta chains, to detect corrupted packs.
+const maxDeltaDepth = 10000
+
+var packIndexMagic = []byte{0xff, 't', 'O', 'c'}
+
+// gitPack reads the objects of a pack file from its version 2 index.
+type gitPack struct {
+	path    string
+	fanout  [256]uint32
+	names   []byte
+	offsets []byte
+	large   []byte
+}
+
+// openGitPack loads the index at path, the pack file being next to it.
+func openGitPack(path string) (*gitPack, error) {
+	idx, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(idx) < 8+256*4 || !bytes.Equal(idx[:4], packIndexMagic) || binary.BigEndian.Uint32(idx[4:8]) != 2 {
+		return nil, fmt.Errorf("unsupported pack index %s", path)
+	}
+	p := &gitPack{path: strings.TrimSuffix(path, ".idx") + ".pack"}
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(idx[8+i*4:])
+	}
+	n := int(p.fanout[255])
+	pos := 8 + 256*4
+	if len(idx) < pos+n*(20+4+4) {
+		return nil, fmt.Errorf("truncated pack index %s", path)
+	}
+	p.names = idx[pos : pos+n*20]
+	pos += n * 20
+	// Skip the CRC32 of the objects.
+	pos += n * 4
+	p.offsets = idx[pos : pos+n*4]
+	pos += n * 4
+	p.large = idx[pos:]
+	return p, nil
+}
+
+// find returns the offset in the pack of the object with the given ID.
+func (p *gitPack) find(id []byte) (int64, bool) {
+	lo := 0
+	if id[0] > 0 {
+		lo = int(p.fanout[id[0]-1])
+	}
+	hi := int(p.fanout[id[0]])
+	for lo < hi {
+		mid := (lo + hi) / 2
+		switch cmp := bytes.Compare(p.names[mid*20:mid*20+20], id); {
+		case cmp == 0:
+			return p.offset(mid), true
+		case cmp < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return 0, false
+}
+
+func (p *gitPack) offset(i int) int64 {
+	offset := binary.BigEndian.Uint32(p.offsets[i*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset)
+	}
+	// The offsets larger than 2GB are stored in a separate table.
+	j := int(offset&0x7fffffff) * 8
+	if j+8 > len(p.large) {
+		return -1
+	}
+	return int64(binary.BigEndian.Uint64(p.large[j:]))
+}
+
+// readObject reads the object at offset, resolving its delta chain.
+func (p *gitPack) readObject(r *gitRepository, offset int64, depth int) (int, []byte, error) {
+	if offset < 0 {
+		return 0, nil, errors.New("invalid pack offset")
+	}
+	if depth > maxDeltaDepth {
+		return 0, nil, errors.New("delta chain too long")
+	}
+	f, err := os.Open(p.path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+
+	// The header is the type and the size of the object, encoded as a variable length integer.
+	b, err := br.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	objType := int(b>>4) & 7
+	size := uint64(b & 0x0f)
+	for shift := uint(4); b&0x80 != 0; shift += 7 {
+		if b, err = br.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+		size |= uint64(b&0x7f) << shift
+	}
+
+	var baseType int
+	var base []byte
+	switch objType {
+	case gitObjectCommit, gitObjectTree, gitObjectBlob, gitObjectTag:
+	case gitObjectOfsDelta:
+		// The base is at a negative offset, encoded with a big endian variable length integer.
+		if b, err = br.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+		rel := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = br.ReadByte(); err != nil {
+				return 0, nil, err
+			}
+			rel = (rel+1)<<7 | int64(b&0x7f)
+		}
+		if baseType, base, err = p.readObject(r, offset-rel, depth+1); err != nil {
+			return 0, nil, err
+		}
+	case gitObjectRefDelta:
+		id := make([]byte, 20)
+		if _, err = io.ReadFull(br, id); err != nil {
+			return 0, nil, err
+		}
+		if baseType, base, err = r.readObject(hex.EncodeToString(id)); err != nil {
+			return 0, nil, err
+		}
+	default:
+		return 0, nil, fmt.Errorf("invalid object type %d", objType)
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return 0, nil, err
+	}
+	if uint64(len(data)) != size {
+		return 0, nil, fmt.Errorf("invalid object size %d, expected %d", len(data), size)
+	}
+	if base == nil {
+		return objType, data, nil
+	}
+	data, err = applyDelta(base, data)
+	return baseType, data, err
+}
+
+// applyDelta rebuilds an object from its base and a delta: the sizes of the base and the result,
+// followed by instructions copying ranges of the base or inserting new data.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errInvalid := errors.New("invalid delta")
+	pos := 0
+	readSize := func() (int, bool) {
+		size, shift := 0, uint(0)
+		for pos < len(delta) {
+			b := delta[pos]
+			pos++
+			size |= int(b&0x7f) << shift
+			shift += 7
+			if b&0x80 == 0 {
+				return size, true
+			}
+		}
+		return 0, false
+	}
+	baseSize, ok := readSize()
+	if !ok || baseSize != len(base) {
+		return nil, errInvalid
+	}
+	resultSize, ok := readSize()
+	if !ok {
+		return nil, errInvalid
+	}
+
+	result := make([]byte, 0, resultSize)
+	for pos < len(delta) {
+		cmd := delta[pos]
+		pos++
+		switch {
+		case cmd&0x80 != 0:
+			// Copy: the bits 0-3 select the bytes of the offset and the bits 4-6 the ones of the size.
+			var offset, size int
+			for i := uint(0); i < 7; i++ {
+				if cmd&(1<<i) == 0 {
+					continue
+				}
+				if pos >= len(delta) {
+					return nil, errInvalid
+				}
+				if i < 4 {
+					offset |= int(delta[pos]) << (8 * i)
+				} else {
+					size |= int(delta[pos]) << (8 * (i - 4))
+				}
+				pos++
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, errInvalid
+			}
+			result = append(result, base[offset:offset+size]...)
+		case cmd != 0:
+			// Insert the next cmd bytes.
+			if pos+int(cmd) > len(delta) {
+				return nil, errInvalid
+			}
+			result = append(result, delta[pos:pos+int(cmd)]...)
+			pos += int(cmd)
+		default:
+			return nil, errInvalid
+		}
+	}
+	if len(result) != resultSize {
+		return nil, errInvalid
+	}
+	return result, nil
+}
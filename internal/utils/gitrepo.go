@@ -0,0 +1,592 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxSymrefDepth bounds the number of symbolic references followed to resolve a reference.
+	maxSymrefDepth = 5
+
+	// maxContainsCommits bounds the number of commits walked to find the branches containing a commit.
+	maxContainsCommits = 10000
+
+	// containsClockSkew is the tolerated clock skew between a commit and its descendants.
+	containsClockSkew = 24 * time.Hour
+)
+
+// gitRepository reads the metadata of a local Git repository without the git binary.
+type gitRepository struct {
+	// gitDir holds the HEAD of the worktree.
+	gitDir string
+	// commonDir holds the references, the objects and the configuration, shared by all the worktrees.
+	commonDir string
+	workTree  string
+
+	objectDirs []string
+	packs      []*gitPack
+	packsRead  bool
+	cfg        gitConfig
+}
+
+// gitSignature is the author or the committer of a commit.
+type gitSignature struct {
+	name  string
+	email string
+	date  time.Time
+}
+
+// gitCommit is a parsed commit object.
+type gitCommit struct {
+	tree      string
+	parents   []string
+	author    gitSignature
+	committer gitSignature
+	message   string
+}
+
+// openGitRepository opens the repository of the working directory, honoring GIT_DIR and GIT_WORK_TREE.
+func openGitRepository() (*gitRepository, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if dir := os.Getenv("GIT_DIR"); dir != "" {
+		workTree := os.Getenv("GIT_WORK_TREE")
+		if workTree == "" {
+			workTree = wd
+		}
+		return newGitRepository(absPath(wd, dir), absPath(wd, workTree))
+	}
+	for dir := wd; ; {
+		if gitDir, err := findGitDir(dir); err == nil {
+			return newGitRepository(gitDir, dir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, errors.New("not a git repository")
+		}
+		dir = parent
+	}
+}
+
+// findGitDir returns the git directory of the worktree dir, following the .git files of the
+// linked worktrees and submodules.
+func findGitDir(dir string) (string, error) {
+	path := filepath.Join(dir, ".git")
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return path, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", fmt.Errorf("invalid gitfile %s", path)
+	}
+	return absPath(dir, strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))), nil
+}
+
+func newGitRepository(gitDir, workTree string) (*gitRepository, error) {
+	if _, err := os.Stat(filepath.Join(gitDir, "HEAD")); err != nil {
+		return nil, err
+	}
+	r := &gitRepository{
+		gitDir:    gitDir,
+		commonDir: gitDir,
+		workTree:  workTree,
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		r.commonDir = absPath(gitDir, strings.TrimSpace(string(content)))
+	}
+	r.objectDirs = readObjectDirs(filepath.Join(r.commonDir, "objects"), 0)
+	return r, nil
+}
+
+// readObjectDirs returns dir and the object directories it borrows objects from.
+func readObjectDirs(dir string, depth int) []string {
+	dirs := []string{dir}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "info", "alternates"))
+	if err != nil || depth >= maxSymrefDepth {
+		return dirs
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		dirs = append(dirs, readObjectDirs(absPath(dir, line), depth+1)...)
+	}
+	return dirs
+}
+
+func absPath(base, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, path)
+}
+
+// isShallow reports whether the repository is a shallow clone, whose history is truncated at the
+// commits listed in the shallow file.
+func (r *gitRepository) isShallow() bool {
+	info, err := os.Stat(filepath.Join(r.commonDir, "shallow"))
+	return err == nil && info.Size() > 0
+}
+
+// head returns the reference checked out, or HEAD if it is detached, and the SHA of its commit.
+func (r *gitRepository) head() (ref string, sha string, err error) {
+	ref = "HEAD"
+	for i := 0; i < maxSymrefDepth; i++ {
+		value, err := r.readRef(ref)
+		if err != nil {
+			return ref, "", err
+		}
+		if !strings.HasPrefix(value, "ref:") {
+			return ref, value, nil
+		}
+		ref = strings.TrimSpace(strings.TrimPrefix(value, "ref:"))
+	}
+	return ref, "", fmt.Errorf("too many levels of symbolic references for %s", ref)
+}
+
+// readRef returns the content of a loose or packed reference: either a SHA or "ref: <target>".
+func (r *gitRepository) readRef(name string) (string, error) {
+	dir := r.commonDir
+	if name == "HEAD" || !strings.HasPrefix(name, "refs/") || strings.HasPrefix(name, "refs/bisect/") ||
+		strings.HasPrefix(name, "refs/worktree/") || strings.HasPrefix(name, "refs/rewritten/") {
+		// Per-worktree references.
+		dir = r.gitDir
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+		return strings.TrimSpace(string(content)), nil
+	}
+	if sha, ok := r.packedRefs()[name]; ok {
+		return sha, nil
+	}
+	return "", fmt.Errorf("reference %s not found", name)
+}
+
+// packedRefs returns the SHA of the references in the packed-refs file.
+func (r *gitRepository) packedRefs() map[string]string {
+	refs := map[string]string{}
+	f, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if err != nil {
+		return refs
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Skip the header and the peeled tags.
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		if fields := strings.Fields(line); len(fields) == 2 {
+			refs[fields[1]] = fields[0]
+		}
+	}
+	return refs
+}
+
+// refs returns the SHA of the references starting with prefix, loose or packed, sorted by name.
+// Symbolic references are ignored.
+func (r *gitRepository) refs(prefix string) ([]string, map[string]string) {
+	refs := map[string]string{}
+	for name, sha := range r.packedRefs() {
+		if strings.HasPrefix(name, prefix) {
+			refs[name] = sha
+		}
+	}
+	root := filepath.Join(r.commonDir, filepath.FromSlash(prefix))
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		value := strings.TrimSpace(string(content))
+		rel, _ := filepath.Rel(root, path)
+		name := prefix + filepath.ToSlash(rel)
+		if strings.HasPrefix(value, "ref:") {
+			delete(refs, name)
+		} else {
+			refs[name] = value
+		}
+		return nil
+	})
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, refs
+}
+
+// peel returns the commit an annotated tag points to, or sha itself if it isn't a tag.
+func (r *gitRepository) peel(sha string) string {
+	for i := 0; i < maxSymrefDepth; i++ {
+		objType, data, err := r.readObject(sha)
+		if err != nil || objType != gitObjectTag {
+			return sha
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "object ") {
+				sha = strings.TrimPrefix(line, "object ")
+				break
+			}
+		}
+	}
+	return sha
+}
+
+// tagsPointingAt returns the names of the tags pointing at the commit sha, as git tag --points-at.
+func (r *gitRepository) tagsPointingAt(sha string) []string {
+	var tags []string
+	names, refs := r.refs("refs/tags/")
+	for _, name := range names {
+		if refs[name] == sha || r.peel(refs[name]) == sha {
+			tags = append(tags, strings.TrimPrefix(name, "refs/tags/"))
+		}
+	}
+	return tags
+}
+
+// remoteBranchContaining returns the first remote branch pointing at the commit sha, or else
+// containing it, as git branch -r --points-at and --contains, without the name of its remote, e.g.
+// main for upstream/main.
+func (r *gitRepository) remoteBranchContaining(sha string) string {
+	remotes := r.remotes()
+	var branches []string
+	names, refs := r.refs("refs/remotes/")
+	for _, name := range names {
+		if !strings.HasSuffix(name, "/HEAD") {
+			branches = append(branches, name)
+		}
+	}
+	for _, name := range branches {
+		if refs[name] == sha {
+			return trimRemote(strings.TrimPrefix(name, "refs/remotes/"), remotes)
+		}
+	}
+
+	commit, err := r.readCommit(sha)
+	if err != nil {
+		return ""
+	}
+	// The commits older than the one searched can't contain it, and as the branches are searched
+	// until one contains it, the commits already visited can't contain it either.
+	minDate := commit.committer.date.Add(-containsClockSkew)
+	visited := map[string]bool{}
+	for _, name := range branches {
+		queue := []string{refs[name]}
+		for len(queue) > 0 && len(visited) < maxContainsCommits {
+			current := queue[0]
+			queue = queue[1:]
+			if current == sha {
+				return trimRemote(strings.TrimPrefix(name, "refs/remotes/"), remotes)
+			}
+			if visited[current] {
+				continue
+			}
+			visited[current] = true
+			c, err := r.readCommit(r.peel(current))
+			if err != nil || c.committer.date.Before(minDate) {
+				continue
+			}
+			queue = append(queue, c.parents...)
+		}
+	}
+	return ""
+}
+
+// trimRemote returns the remote branch name, e.g. upstream/main, without the name of its remote: the
+// longest of remotes prefixing it, or else its first element.
+func trimRemote(name string, remotes []string) string {
+	remote := ""
+	for _, r := range remotes {
+		if strings.HasPrefix(name, r+"/") && len(r) > len(remote) {
+			remote = r
+		}
+	}
+	if remote != "" {
+		return strings.TrimPrefix(name, remote+"/")
+	}
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// config returns the configuration of the repository, overridden by GIT_CONFIG_COUNT,
+// GIT_CONFIG_KEY_<n> and GIT_CONFIG_VALUE_<n>.
+func (r *gitRepository) config() gitConfig {
+	if r.cfg != nil {
+		return r.cfg
+	}
+	r.cfg = gitConfig{}
+	if content, err := ioutil.ReadFile(filepath.Join(r.commonDir, "config")); err == nil {
+		r.cfg.parse(string(content))
+	}
+	if count, err := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT")); err == nil {
+		for i := 0; i < count; i++ {
+			key := os.Getenv(fmt.Sprintf("GIT_CONFIG_KEY_%d", i))
+			if key != "" {
+				r.cfg.add(key, os.Getenv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", i)))
+			}
+		}
+	}
+	return r.cfg
+}
+
+// remotes returns the names of the remotes with a URL, sorted as with git remote.
+func (r *gitRepository) remotes() []string {
+	var names []string
+	for key, values := range r.config() {
+		if strings.HasPrefix(key, "remote.") && strings.HasSuffix(key, ".url") && len(values) > 0 {
+			names = append(names, strings.TrimSuffix(strings.TrimPrefix(key, "remote."), ".url"))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// remoteURL returns the URL of the remote chosen by chooseRemote. As with git, the first URL of a
+// remote is used.
+func (r *gitRepository) remoteURL() string {
+	remote := chooseRemote(r.remotes())
+	if remote == "" {
+		return ""
+	}
+	return firstValue(r.config().getAll("remote." + remote + ".url"))
+}
+
+// superproject returns the outermost superproject of the submodule of the repository, or nil if it
+// isn't a submodule.
+func (r *gitRepository) superproject() *gitRepository {
+	if os.Getenv("GIT_DIR") != "" {
+		return nil
+	}
+	var super *gitRepository
+	for sub := r; ; {
+		parent := enclosingGitRepository(filepath.Dir(sub.workTree))
+		if parent == nil || !parent.hasSubmodule(sub) {
+			return super
+		}
+		super, sub = parent, parent
+	}
+}
+
+// enclosingGitRepository opens the repository whose worktree holds dir, or returns nil.
+func enclosingGitRepository(dir string) *gitRepository {
+	for {
+		if gitDir, err := findGitDir(dir); err == nil {
+			repo, err := newGitRepository(gitDir, dir)
+			if err != nil {
+				return nil
+			}
+			return repo
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// hasSubmodule reports whether sub, whose worktree is in the worktree of the repository, is one of
+// its submodules: either its git directory is in the modules directory of the repository, or its
+// path is declared in .gitmodules.
+func (r *gitRepository) hasSubmodule(sub *gitRepository) bool {
+	if strings.HasPrefix(sub.commonDir, filepath.Join(r.commonDir, "modules")+string(filepath.Separator)) {
+		return true
+	}
+	path, err := filepath.Rel(r.workTree, sub.workTree)
+	if err != nil {
+		return false
+	}
+	content, err := ioutil.ReadFile(filepath.Join(r.workTree, ".gitmodules"))
+	if err != nil {
+		return false
+	}
+	modules := gitConfig{}
+	modules.parse(string(content))
+	for key, values := range modules {
+		if strings.HasPrefix(key, "submodule.") && strings.HasSuffix(key, ".path") && len(values) > 0 {
+			if filepath.Clean(filepath.FromSlash(values[len(values)-1])) == path {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// readCommit reads and parses the commit with the given SHA.
+func (r *gitRepository) readCommit(sha string) (gitCommit, error) {
+	objType, data, err := r.readObject(sha)
+	if err != nil {
+		return gitCommit{}, err
+	}
+	if objType != gitObjectCommit {
+		return gitCommit{}, fmt.Errorf("object %s is not a commit", sha)
+	}
+	return parseCommit(data), nil
+}
+
+// readObject reads the object with the given SHA, either loose or packed.
+func (r *gitRepository) readObject(sha string) (objType int, data []byte, err error) {
+	id, err := hex.DecodeString(sha)
+	if err != nil || len(id) != 20 {
+		return 0, nil, fmt.Errorf("invalid object name %q", sha)
+	}
+	for _, dir := range r.objectDirs {
+		objType, data, err := readLooseObject(filepath.Join(dir, sha[:2], sha[2:]))
+		if err == nil {
+			return objType, data, nil
+		}
+		if !os.IsNotExist(err) {
+			return 0, nil, fmt.Errorf("object %s: %v", sha, err)
+		}
+	}
+	for _, pack := range r.readPacks() {
+		if offset, ok := pack.find(id); ok {
+			objType, data, err := pack.readObject(r, offset, 0)
+			if err != nil {
+				return 0, nil, fmt.Errorf("object %s: %v", sha, err)
+			}
+			return objType, data, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("object %s not found", sha)
+}
+
+// readPacks returns the pack files of the repository.
+func (r *gitRepository) readPacks() []*gitPack {
+	if r.packsRead {
+		return r.packs
+	}
+	r.packsRead = true
+	for _, dir := range r.objectDirs {
+		paths, _ := filepath.Glob(filepath.Join(dir, "pack", "*.idx"))
+		for _, path := range paths {
+			if pack, err := openGitPack(path); err == nil {
+				r.packs = append(r.packs, pack)
+			}
+		}
+	}
+	return r.packs
+}
+
+// readLooseObject reads a zlib-compressed object: "<type> <size>\x00<data>".
+func readLooseObject(path string) (int, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+	content, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return 0, nil, err
+	}
+	i := bytes.IndexByte(content, 0)
+	if i < 0 {
+		return 0, nil, errors.New("invalid loose object header")
+	}
+	header := strings.SplitN(string(content[:i]), " ", 2)
+	objType, ok := gitObjectTypes[header[0]]
+	if !ok || len(header) != 2 {
+		return 0, nil, fmt.Errorf("invalid loose object header %q", content[:i])
+	}
+	data := content[i+1:]
+	if size, err := strconv.Atoi(header[1]); err != nil || size != len(data) {
+		return 0, nil, fmt.Errorf("invalid loose object size %q", header[1])
+	}
+	return objType, data, nil
+}
+
+// parseCommit parses the headers and the message of a commit object.
+func parseCommit(data []byte) gitCommit {
+	var commit gitCommit
+	content := string(data)
+	headers := content
+	if i := strings.Index(content, "\n\n"); i >= 0 {
+		headers, commit.message = content[:i], content[i+2:]
+	}
+	for _, line := range strings.Split(headers, "\n") {
+		// Continuation lines of multi-line headers, e.g. gpgsig, start with a space.
+		if line == "" || line[0] == ' ' {
+			continue
+		}
+		kv := strings.SplitN(line, " ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "tree":
+			commit.tree = kv[1]
+		case "parent":
+			commit.parents = append(commit.parents, kv[1])
+		case "author":
+			commit.author = parseSignature(kv[1])
+		case "committer":
+			commit.committer = parseSignature(kv[1])
+		}
+	}
+	return commit
+}
+
+// parseSignature parses "Name <email> <unix time> <timezone>".
+func parseSignature(s string) gitSignature {
+	var sig gitSignature
+	start := strings.IndexByte(s, '<')
+	end := strings.LastIndexByte(s, '>')
+	if start < 0 || end < start {
+		sig.name = strings.TrimSpace(s)
+		return sig
+	}
+	sig.name = strings.TrimSpace(s[:start])
+	sig.email = s[start+1 : end]
+	if fields := strings.Fields(s[end+1:]); len(fields) > 0 {
+		if ts, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			sig.date = time.Unix(ts, 0)
+		}
+	}
+	return sig
+}
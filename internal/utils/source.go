@@ -0,0 +1,165 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// sourceFile is a parsed Go source file.
+type sourceFile struct {
+	fset *token.FileSet
+	file *ast.File
+}
+
+var (
+	sourceFilesMu sync.Mutex
+	// sourceFiles caches the parsed source files, nil for the ones that can't be parsed.
+	sourceFiles = map[string]*sourceFile{}
+
+	// mainModulePath and mainModuleDir are the path and the directory of the module holding the
+	// working directory, found once.
+	mainModuleOnce sync.Once
+	mainModulePath string
+	mainModuleDir  string
+)
+
+// GetSourceRange returns the source file of the code at the given program counter, and the lines
+// of the declaration of the function holding it: the top-level function, or else the innermost
+// function literal, e.g. a test registered in a variable declaration. A subtest run by t.Run with a
+// function literal thus gets the lines of its parent test function. The lines are 0 if the source
+// file can't be parsed. The paths made relative to their module by go build -trimpath are resolved
+// with ResolveSourcePath.
+func GetSourceRange(pc uintptr) (file string, start, end int) {
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "", 0, 0
+	}
+	file, line := fn.FileLine(pc)
+	file = ResolveSourcePath(file)
+	src := parseSourceFile(file)
+	if src == nil {
+		return file, 0, 0
+	}
+
+	contains := func(n ast.Node) bool {
+		return src.fset.Position(n.Pos()).Line <= line && line <= src.fset.Position(n.End()).Line
+	}
+	var decl ast.Node
+	for _, d := range src.file.Decls {
+		if contains(d) {
+			if _, ok := d.(*ast.FuncDecl); ok {
+				decl = d
+			} else {
+				ast.Inspect(d, func(n ast.Node) bool {
+					if n == nil || !contains(n) {
+						return false
+					}
+					if _, ok := n.(*ast.FuncLit); ok {
+						decl = n
+					}
+					return true
+				})
+			}
+			break
+		}
+	}
+	if decl == nil {
+		return file, 0, 0
+	}
+	return file, src.fset.Position(decl.Pos()).Line, src.fset.Position(decl.End()).Line
+}
+
+// ResolveSourcePath returns the absolute path of a source file of the main module, the module holding
+// the working directory, when it is reported relative to the module, as with go build -trimpath, e.g.
+// github.com/DataDog/dd-sdk-go-testing/init_test.go. The other paths are returned unchanged.
+func ResolveSourcePath(file string) string {
+	if file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	mainModuleOnce.Do(findMainModule)
+	if mainModulePath != "" && strings.HasPrefix(file, mainModulePath+"/") {
+		return filepath.Join(mainModuleDir, filepath.FromSlash(strings.TrimPrefix(file, mainModulePath+"/")))
+	}
+	return file
+}
+
+// findMainModule finds the go.mod file of the working directory, or of its closest parent.
+func findMainModule() {
+	dir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	for {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			mainModulePath, mainModuleDir = modulePath(data), dir
+			return
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+}
+
+// modulePath returns the path of the module declared by the go.mod file.
+func modulePath(gomod []byte) string {
+	for _, line := range strings.Split(string(gomod), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], "\"`")
+		}
+	}
+	return ""
+}
+
+// GetTestSourceRange returns the test file of the package in dir declaring the given test, and the
+// lines of its declaration. A subtest gets the lines of its top-level test function. The file is
+// empty if the declaration can't be found.
+func GetTestSourceRange(dir, test string) (file string, start, end int) {
+	if i := strings.IndexByte(test, '/'); i >= 0 {
+		test = test[:i]
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*_test.go"))
+	for _, path := range paths {
+		src := parseSourceFile(path)
+		if src == nil {
+			continue
+		}
+		for _, d := range src.file.Decls {
+			if fn, ok := d.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == test {
+				return path, src.fset.Position(fn.Pos()).Line, src.fset.Position(fn.End()).Line
+			}
+		}
+	}
+	return "", 0, 0
+}
+
+func parseSourceFile(path string) *sourceFile {
+	sourceFilesMu.Lock()
+	defer sourceFilesMu.Unlock()
+	if src, ok := sourceFiles[path]; ok {
+		return src
+	}
+	var src *sourceFile
+	fset := token.NewFileSet()
+	if file, err := parser.ParseFile(fset, path, nil, 0); err == nil {
+		src = &sourceFile{fset: fset, file: file}
+	}
+	sourceFiles[path] = src
+	return src
+}
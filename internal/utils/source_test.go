@@ -0,0 +1,84 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func callerPC() uintptr {
+	pc, _, _, _ := runtime.Caller(1)
+	return pc
+}
+
+var closurePC = func() uintptr {
+	return callerPC()
+}
+
+func TestGetSourceRange(t *testing.T) {
+	pc := callerPC()
+	var subPC uintptr
+	func() {
+		subPC = callerPC()
+	}()
+
+	for _, tt := range []struct {
+		pc         uintptr
+		start, end int
+	}{
+		{pc, 23, 43},
+		{subPC, 23, 43},
+		{closurePC(), 19, 21},
+	} {
+		file, start, end := GetSourceRange(tt.pc)
+		if filepath.Base(file) != "source_test.go" || start != tt.start || end != tt.end {
+			t.Errorf("expected source_test.go:%d-%d, got %s:%d-%d", tt.start, tt.end, file, start, end)
+		}
+	}
+}
+
+func TestGetTestSourceRange(t *testing.T) {
+	for _, name := range []string{"TestGetSourceRange", "TestGetSourceRange/sub"} {
+		file, start, end := GetTestSourceRange(".", name)
+		if filepath.Base(file) != "source_test.go" || start != 23 || end != 43 {
+			t.Errorf("%s: expected source_test.go:23-43, got %s:%d-%d", name, file, start, end)
+		}
+	}
+	if file, _, _ := GetTestSourceRange(".", "TestMissing"); file != "" {
+		t.Errorf("expected no source for a missing test, got %s", file)
+	}
+}
+
+func TestResolveSourcePath(t *testing.T) {
+	abs, err := filepath.Abs("source.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string]string{
+		// As reported with go build -trimpath.
+		"github.com/DataDog/dd-sdk-go-testing/internal/utils/source.go": abs,
+		abs:                               abs,
+		"github.com/other/module/file.go": "github.com/other/module/file.go",
+	} {
+		if actual := ResolveSourcePath(path); actual != expected {
+			t.Errorf("expected %s to be resolved to %s, got %s", path, expected, actual)
+		}
+	}
+}
+
+func TestModulePath(t *testing.T) {
+	for gomod, expected := range map[string]string{
+		"module github.com/DataDog/dd-sdk-go-testing\n\ngo 1.12\n":    "github.com/DataDog/dd-sdk-go-testing",
+		"// A comment\nmodule \"example.com/quoted\" // the module\n": "example.com/quoted",
+		"go 1.12\n": "",
+	} {
+		if actual := modulePath([]byte(gomod)); actual != expected {
+			t.Errorf("expected the module %q, got %q", expected, actual)
+		}
+	}
+}
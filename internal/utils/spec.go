@@ -0,0 +1,104 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"sort"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+)
+
+// SpecTags are the tags of ci-app-spec.json, for the commands that can't read the file.
+var SpecTags = []string{
+	"_dd.ci.env_vars",
+	"_dd.origin",
+	"ci.job.name",
+	"ci.job.url",
+	"ci.pipeline.id",
+	"ci.pipeline.name",
+	"ci.pipeline.number",
+	"ci.pipeline.url",
+	"ci.provider.name",
+	"ci.stage.name",
+	"ci.workspace_path",
+	"git.branch",
+	"git.commit.author.date",
+	"git.commit.author.email",
+	"git.commit.author.name",
+	"git.commit.committer.date",
+	"git.commit.committer.email",
+	"git.commit.committer.name",
+	"git.commit.message",
+	"git.commit.sha",
+	"git.repository_url",
+	"git.tag",
+	"language",
+	"os.architecture",
+	"os.platform",
+	"os.version",
+	"runtime.name",
+	"runtime.version",
+	"test.framework",
+	"test.name",
+	"test.status",
+	"test.suite",
+	"test.type",
+}
+
+// requiredTags are the tags that are expected to be detected everywhere, when the spec has them.
+var requiredTags = []string{
+	constants.GitRepositoryURL,
+	constants.GitCommitSHA,
+	constants.OSPlatform,
+	constants.OSVersion,
+	constants.OSArchitecture,
+	constants.RuntimeName,
+	constants.RuntimeVersion,
+}
+
+// requiredProviderTags are the tags that are expected to be detected when the tests run in a CI
+// provider, when the spec has them.
+var requiredProviderTags = []string{
+	constants.CIProviderName,
+	constants.CIPipelineID,
+	constants.CIPipelineURL,
+	constants.CIWorkspacePath,
+}
+
+// RequiredTags returns the tags of spec that are expected to be detected, in a CI provider or not.
+func RequiredTags(spec []string, provider bool) []string {
+	inSpec := map[string]bool{}
+	for _, tag := range spec {
+		inSpec[tag] = true
+	}
+	candidates := requiredTags
+	if provider {
+		candidates = append(append([]string{}, candidates...), requiredProviderTags...)
+	}
+	var required []string
+	for _, tag := range candidates {
+		if inSpec[tag] {
+			required = append(required, tag)
+		}
+	}
+	return required
+}
+
+// NotInSpec returns the sorted tags that are not in spec, e.g. the tags added since the spec.
+func NotInSpec(tags map[string]string, spec []string) []string {
+	inSpec := map[string]bool{}
+	for _, tag := range spec {
+		inSpec[tag] = true
+	}
+	var keys []string
+	for key := range tags {
+		if !inSpec[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,123 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package utils
+
+import (
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+)
+
+var repoRegex = regexp.MustCompile(`(?m)\/([a-zA-Z0-9\\\-_.]*)$`)
+
+// GetCITags returns the tags describing the CI provider, the Git commit, the OS and the runtime
+// the tests are executed on. The Git metadata is read from the local repository when the CI
+// provider doesn't expose it.
+func GetCITags() map[string]string {
+	tags, _ := GetCITagsWithDiagnostics()
+	return tags
+}
+
+// GetCITagsWithDiagnostics is like GetCITags but also returns how the tags were detected.
+func GetCITagsWithDiagnostics() (map[string]string, *Diagnostics) {
+	diag := newDiagnostics()
+	localTags := getProviderTags(diag)
+
+	before := copyTags(localTags)
+	localTags[constants.OSPlatform] = runtime.GOOS
+	localTags[constants.OSVersion] = OSVersion()
+	localTags[constants.OSArchitecture] = runtime.GOARCH
+	localTags[constants.RuntimeName] = runtime.Compiler
+	localTags[constants.RuntimeVersion] = runtime.Version()
+	diag.track(before, localTags, SourceEnv)
+
+	before = copyTags(localTags)
+	gitData, err := LocalGetGitData()
+	if err != nil {
+		diag.addError("cannot read the local git repository: %v", err)
+	}
+
+	// Guess Git metadata from a local Git repository otherwise.
+	if _, ok := localTags[constants.CIWorkspacePath]; !ok {
+		localTags[constants.CIWorkspacePath] = gitData.SourceRoot
+	}
+	if _, ok := localTags[constants.GitRepositoryURL]; !ok {
+		localTags[constants.GitRepositoryURL] = gitData.RepositoryUrl
+	}
+	if _, ok := localTags[constants.GitCommitSHA]; !ok {
+		localTags[constants.GitCommitSHA] = gitData.CommitSha
+	}
+	if _, ok := localTags[constants.GitBranch]; !ok {
+		localTags[constants.GitBranch] = gitData.Branch
+	}
+
+	if gitData.CommitSha != "" && localTags[constants.GitCommitSHA] == gitData.CommitSha {
+		if _, ok := localTags[constants.GitTag]; !ok && gitData.Tag != "" {
+			localTags[constants.GitTag] = gitData.Tag
+		}
+		if _, ok := localTags[constants.GitCommitAuthorDate]; !ok {
+			localTags[constants.GitCommitAuthorDate] = gitData.AuthorDate.String()
+		}
+		if _, ok := localTags[constants.GitCommitAuthorName]; !ok {
+			localTags[constants.GitCommitAuthorName] = gitData.AuthorName
+		}
+		if _, ok := localTags[constants.GitCommitAuthorEmail]; !ok {
+			localTags[constants.GitCommitAuthorEmail] = gitData.AuthorEmail
+		}
+		if _, ok := localTags[constants.GitCommitCommitterDate]; !ok {
+			localTags[constants.GitCommitCommitterDate] = gitData.CommitterDate.String()
+		}
+		if _, ok := localTags[constants.GitCommitCommitterName]; !ok {
+			localTags[constants.GitCommitCommitterName] = gitData.CommitterName
+		}
+		if _, ok := localTags[constants.GitCommitCommitterEmail]; !ok {
+			localTags[constants.GitCommitCommitterEmail] = gitData.CommitterEmail
+		}
+		if _, ok := localTags[constants.GitCommitMessage]; !ok {
+			localTags[constants.GitCommitMessage] = gitData.CommitMessage
+		}
+		if gitData.SubmoduleCommitSha != "" {
+			localTags[constants.GitSubmoduleRepositoryURL] = gitData.SubmoduleRepositoryUrl
+			localTags[constants.GitSubmoduleCommitSHA] = gitData.SubmoduleCommitSha
+		}
+
+		// Tell apart the runs on uncommitted changes from the ones on the commit.
+		diffHash, _ := strconv.ParseBool(os.Getenv("DD_CIVISIBILITY_GIT_DIFF_HASH_ENABLED"))
+		status, err := LocalGetGitStatus(diffHash)
+		if err != nil {
+			diag.addError("cannot read the status of the local git repository: %v", err)
+		} else {
+			localTags[constants.GitDirty] = strconv.FormatBool(status.Dirty())
+			if status.Dirty() {
+				localTags[constants.GitDirtyModifiedFiles] = strconv.Itoa(status.ModifiedFiles)
+				localTags[constants.GitDirtyUntrackedFiles] = strconv.Itoa(status.UntrackedFiles)
+			}
+			if status.DiffSHA != "" {
+				localTags[constants.GitDirtyDiffSHA] = status.DiffSHA
+			}
+		}
+	}
+
+	// Normalize the local values as the ones of the CI provider, e.g. origin/main becomes main.
+	normalizeTags(localTags)
+	diag.track(before, localTags, SourceLocalGit)
+	diag.check(localTags)
+
+	return localTags, diag
+}
+
+// RepositoryName returns the name of the repository at the given URL, used as the default service name.
+func RepositoryName(repoUrl string) string {
+	matches := repoRegex.FindStringSubmatch(repoUrl)
+	if len(matches) > 1 {
+		repoUrl = strings.TrimSuffix(matches[1], ".git")
+	}
+	return repoUrl
+}
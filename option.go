@@ -6,10 +6,12 @@
 package dd_sdk_go_testing
 
 import (
-	"runtime"
+	"net/http"
 	"sync"
 
 	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/export"
+	"github.com/DataDog/dd-sdk-go-testing/internal/testspan"
 	"github.com/DataDog/dd-sdk-go-testing/internal/utils"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
@@ -20,6 +22,16 @@ var (
 	// tags contains information detected from CI/CD environment variables.
 	tags     map[string]string
 	tagsOnce sync.Once
+
+	// diagnostics records how tags were detected.
+	diagnostics *utils.Diagnostics
+
+	// directives are the directives of the commit message, e.g. [dd skip-git-upload].
+	directives utils.Directives
+
+	// gitDiff contains the lines changed by the pull request tested, nil outside of pull requests.
+	gitDiff     utils.GitDiff
+	gitDiffOnce sync.Once
 )
 
 type config struct {
@@ -36,7 +48,7 @@ func defaults(cfg *config) {
 	cfg.skip = 1
 	cfg.spanOpts = []ddtrace.StartSpanOption{
 		tracer.SpanType(constants.SpanTypeTest),
-		tracer.Tag(constants.SpanKind, spanKind),
+		tracer.Tag(constants.SpanKind, testspan.Kind),
 		tracer.Tag(ext.ManualKeep, true),
 	}
 
@@ -54,55 +66,24 @@ func ensureCITags() {
 }
 
 func ensureCITagsLocked() {
-	localTags := utils.GetProviderTags()
-	localTags[constants.OSPlatform] = runtime.GOOS
-	localTags[constants.OSVersion] = utils.OSVersion()
-	localTags[constants.OSArchitecture] = runtime.GOARCH
-	localTags[constants.RuntimeName] = runtime.Compiler
-	localTags[constants.RuntimeVersion] = runtime.Version()
-
-	gitData, _ := utils.LocalGetGitData()
-
-	// Guess Git metadata from a local Git repository otherwise.
-	if _, ok := localTags[constants.CIWorkspacePath]; !ok {
-		localTags[constants.CIWorkspacePath] = gitData.SourceRoot
-	}
-	if _, ok := localTags[constants.GitRepositoryURL]; !ok {
-		localTags[constants.GitRepositoryURL] = gitData.RepositoryUrl
-	}
-	if _, ok := localTags[constants.GitCommitSHA]; !ok {
-		localTags[constants.GitCommitSHA] = gitData.CommitSha
-	}
-	if _, ok := localTags[constants.GitBranch]; !ok {
-		localTags[constants.GitBranch] = gitData.Branch
-	}
-
-	if localTags[constants.GitCommitSHA] == gitData.CommitSha {
-		if _, ok := localTags[constants.GitCommitAuthorDate]; !ok {
-			localTags[constants.GitCommitAuthorDate] = gitData.AuthorDate.String()
-		}
-		if _, ok := localTags[constants.GitCommitAuthorName]; !ok {
-			localTags[constants.GitCommitAuthorName] = gitData.AuthorName
-		}
-		if _, ok := localTags[constants.GitCommitAuthorEmail]; !ok {
-			localTags[constants.GitCommitAuthorEmail] = gitData.AuthorEmail
-		}
-		if _, ok := localTags[constants.GitCommitCommitterDate]; !ok {
-			localTags[constants.GitCommitCommitterDate] = gitData.CommitterDate.String()
-		}
-		if _, ok := localTags[constants.GitCommitCommitterName]; !ok {
-			localTags[constants.GitCommitCommitterName] = gitData.CommitterName
-		}
-		if _, ok := localTags[constants.GitCommitCommitterEmail]; !ok {
-			localTags[constants.GitCommitCommitterEmail] = gitData.CommitterEmail
-		}
-		if _, ok := localTags[constants.GitCommitMessage]; !ok {
-			localTags[constants.GitCommitMessage] = gitData.CommitMessage
-		}
+	// Replace global tags with local copy
+	tags, diagnostics = utils.GetCITagsWithDiagnostics()
+	if utils.DebugEnabled() {
+		diagnostics.Log()
 	}
+	directives = utils.ParseDirectives(tags[constants.GitCommitMessage])
+	directives.ApplyTags(tags)
+}
 
-	// Replace global tags with local copy
-	tags = localTags
+// getGitDiff returns the lines changed since the merge-base with the base branch of the pull
+// request tested, or nil. It is computed by Run before the tests start, so that it doesn't add to
+// the duration of the first test.
+func getGitDiff() utils.GitDiff {
+	gitDiffOnce.Do(func() {
+		ensureCITags()
+		gitDiff = testspan.GitDiff(tags)
+	})
+	return gitDiff
 }
 
 func getFromCITags(key string) (string, bool) {
@@ -119,6 +100,17 @@ func forEachCITags(itemFunc func(string, string)) {
 	}
 }
 
+// sourceOptions returns the span options locating the source of the test at the given program
+// counter, relative to the workspace path, and telling whether it changed in the pull request tested.
+// The subtests declared in a function literal get the lines of their top-level test function.
+func sourceOptions(pc uintptr) []ddtrace.StartSpanOption {
+	file, start, end := utils.GetSourceRange(pc)
+	if file == "" {
+		return nil
+	}
+	return testspan.SourceOptions(file, start, end, tags, getGitDiff())
+}
+
 // WithSpanOptions defines a set of additional ddtrace.StartSpanOption to be added
 // to spans started by the integration.
 func WithSpanOptions(opts ...ddtrace.StartSpanOption) Option {
@@ -141,3 +133,96 @@ func WithIncrementSkipFrame() Option {
 		cfg.skip = cfg.skip + 1
 	}
 }
+
+type runConfig struct {
+	tracerOpts []tracer.StartOption
+	export.Config
+}
+
+// RunOption represents an option that can be passed to RunWithOptions.
+type RunOption func(*runConfig)
+
+func runDefaults(cfg *runConfig) {
+	cfg.Config = export.ConfigFromEnv()
+}
+
+// WithTracerOptions defines a set of tracer.StartOption used to start the tracer. The agent is
+// configured with WithAgentAddr and WithHTTPClient instead, which override tracer.WithAgentAddr,
+// tracer.WithHTTPClient and tracer.WithUDS.
+func WithTracerOptions(opts ...tracer.StartOption) RunOption {
+	return func(cfg *runConfig) {
+		cfg.tracerOpts = append(cfg.tracerOpts, opts...)
+	}
+}
+
+// WithAgentAddr sets the address of the agent the tracer and the SDK send the payloads to. As for
+// the tracer, it is overridden by the DD_AGENT_HOST and DD_TRACE_AGENT_PORT environment variables.
+func WithAgentAddr(addr string) RunOption {
+	return func(cfg *runConfig) {
+		cfg.AgentAddr = addr
+	}
+}
+
+// WithHTTPClient sets the client the tracer and the SDK reach the agent with, e.g. through a unix
+// socket.
+func WithHTTPClient(client *http.Client) RunOption {
+	return func(cfg *runConfig) {
+		cfg.HTTPClient = client
+	}
+}
+
+// WithOutputFile writes the test events as newline-delimited JSON to the file at path instead
+// of sending them, so they can be uploaded later on with the `ddtest upload` command.
+// It overrides the DD_CIVISIBILITY_OUTPUT_FILE environment variable.
+func WithOutputFile(path string) RunOption {
+	return func(cfg *runConfig) {
+		cfg.OutputFile = path
+	}
+}
+
+// WithJUnitReport writes a JUnit XML report of the executed tests to the file at path, or to a file
+// named after the test module if path is a directory. It overrides the DD_CIVISIBILITY_JUNIT_REPORT
+// environment variable.
+func WithJUnitReport(path string) RunOption {
+	return func(cfg *runConfig) {
+		cfg.JUnitReport = path
+	}
+}
+
+// WithOTLPEndpoint sends the test spans to the OTLP/HTTP endpoint of an OpenTelemetry collector
+// instead of Datadog. The /v1/traces path is used when endpoint has none. It overrides the
+// DD_CIVISIBILITY_OTLP_ENDPOINT environment variable.
+func WithOTLPEndpoint(endpoint string) RunOption {
+	return func(cfg *runConfig) {
+		cfg.OTLPEndpoint = endpoint
+	}
+}
+
+// WithSummary prints a summary of the executed tests to stderr once they have all run, listing the
+// given number of slowest tests. It overrides the DD_CIVISIBILITY_SUMMARY and
+// DD_CIVISIBILITY_SUMMARY_SLOWEST environment variables.
+func WithSummary(slowest int) RunOption {
+	return func(cfg *runConfig) {
+		cfg.Summary = true
+		cfg.SummarySlowest = slowest
+	}
+}
+
+// WithGitUpload enables or disables the upload of the recent commits of the repository, used by
+// Datadog to select the tests impacted by a change. It is enabled by default, when the test events
+// are sent to Datadog. It overrides the DD_CIVISIBILITY_GIT_UPLOAD_ENABLED environment variable.
+func WithGitUpload(enabled bool) RunOption {
+	return func(cfg *runConfig) {
+		cfg.GitUpload = enabled
+	}
+}
+
+// WithGitUnshallow enables or disables fetching the history of the last month of shallow clones before
+// uploading the commits of the repository. It is disabled by default, as it updates the clone the
+// tests run in. It overrides the
+// DD_CIVISIBILITY_GIT_UNSHALLOW_ENABLED environment variable.
+func WithGitUnshallow(enabled bool) RunOption {
+	return func(cfg *runConfig) {
+		cfg.GitUnshallow = enabled
+	}
+}
@@ -0,0 +1,198 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2021 Datadog, Inc.
+
+package dd_sdk_go_testing
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/dd-sdk-go-testing/internal/constants"
+	"github.com/DataDog/dd-sdk-go-testing/internal/export"
+	"github.com/DataDog/dd-sdk-go-testing/internal/gitupload"
+	"github.com/DataDog/dd-sdk-go-testing/internal/testhook"
+	"github.com/DataDog/dd-sdk-go-testing/internal/testspan"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+var (
+	// currentSession is the test session started by Run, nil when Run is not used. It is replaced
+	// by the session of a ddtestingtest.Recorder while the recorder runs.
+	currentSession *session
+	// currentExporter exports the test events while Run executes the tests.
+	currentExporter *export.Exporter
+	// currentMu guards currentSession and currentExporter.
+	currentMu sync.RWMutex
+)
+
+func init() {
+	testhook.StartSession = func() func() {
+		ensureCITags()
+		s := startSession()
+		currentMu.Lock()
+		previous := currentSession
+		currentSession = s
+		currentMu.Unlock()
+		return func() {
+			s.finish()
+			currentMu.Lock()
+			currentSession = previous
+			currentMu.Unlock()
+		}
+	}
+	testhook.RestoreTracer = func() {
+		currentMu.RLock()
+		defer currentMu.RUnlock()
+		if currentExporter != nil {
+			currentExporter.Restart()
+		}
+	}
+}
+
+// getCurrentSession returns the test session the tests are linked to, or nil.
+func getCurrentSession() *session {
+	currentMu.RLock()
+	defer currentMu.RUnlock()
+	return currentSession
+}
+
+// session groups the tests executed by a test binary into test session, module and suite spans.
+type session struct {
+	mu             sync.Mutex
+	span           ddtrace.Span
+	status         string
+	module         ddtrace.Span
+	moduleName     string
+	moduleStatus   string
+	moduleFinished bool
+	suites         map[string]*suite
+}
+
+type suite struct {
+	span   ddtrace.Span
+	status string
+}
+
+func startSession() *session {
+	s := &session{
+		suites: map[string]*suite{},
+	}
+	command := strings.Join(append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...), " ")
+	opts := []ddtrace.StartSpanOption{
+		tracer.ResourceName(command),
+		tracer.Tag(constants.TestCommand, command),
+		tracer.Tag(constants.CIDiagnostics, diagnostics.String()),
+	}
+	if len(directives.Names) > 0 {
+		opts = append(opts, tracer.Tag(constants.CIDirectives, strings.Join(directives.Names, ",")))
+	}
+	s.span = tracer.StartSpan("go.test_session", s.spanOptions(constants.SpanTypeTestSession, opts...)...)
+	s.module = tracer.StartSpan("go.test_module", s.spanOptions(constants.SpanTypeTestModule,
+		tracer.Tag(constants.TestSessionID, testspan.FormatID(s.span.Context().SpanID())),
+	)...)
+	return s
+}
+
+func (s *session) spanOptions(spanType string, opts ...ddtrace.StartSpanOption) []ddtrace.StartSpanOption {
+	return testspan.Options(spanType, tags, opts...)
+}
+
+// testOptions returns the span options linking a test of the given suite to the session.
+func (s *session) testOptions(suiteName string) []ddtrace.StartSpanOption {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.moduleName == "" {
+		// A Go test binary tests a single package, the module is named after the first suite.
+		s.moduleName = suiteName
+	}
+	st, ok := s.suites[suiteName]
+	if !ok {
+		st = &suite{
+			span: tracer.StartSpan("go.test_suite", s.spanOptions(constants.SpanTypeTestSuite,
+				tracer.ResourceName(suiteName),
+				tracer.Tag(constants.TestSuite, suiteName),
+				tracer.Tag(constants.TestModule, s.moduleName),
+				tracer.Tag(constants.TestSessionID, testspan.FormatID(s.span.Context().SpanID())),
+				tracer.Tag(constants.TestModuleID, testspan.FormatID(s.module.Context().SpanID())),
+			)...),
+		}
+		s.suites[suiteName] = st
+	}
+
+	return []ddtrace.StartSpanOption{
+		tracer.Tag(constants.TestModule, s.moduleName),
+		tracer.Tag(constants.TestSessionID, testspan.FormatID(s.span.Context().SpanID())),
+		tracer.Tag(constants.TestModuleID, testspan.FormatID(s.module.Context().SpanID())),
+		tracer.Tag(constants.TestSuiteID, testspan.FormatID(st.span.Context().SpanID())),
+	}
+}
+
+// testFinished records the status of a finished test of the given suite.
+func (s *session) testFinished(suiteName, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st, ok := s.suites[suiteName]; ok {
+		st.status = testspan.MergeStatus(st.status, status)
+	}
+	s.moduleStatus = testspan.MergeStatus(s.moduleStatus, status)
+	s.status = testspan.MergeStatus(s.status, status)
+}
+
+// finishModule finishes all the suites and the module spans.
+func (s *session) finishModule() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finishModuleLocked()
+}
+
+func (s *session) finishModuleLocked() {
+	if s.moduleFinished {
+		return
+	}
+	s.moduleFinished = true
+
+	for _, st := range s.suites {
+		testspan.Finish(st.span, st.status, "", time.Time{})
+	}
+	s.suites = map[string]*suite{}
+
+	moduleName := s.moduleName
+	if moduleName == "" {
+		moduleName = strings.TrimSuffix(filepath.Base(os.Args[0]), ".test")
+	}
+	s.module.SetTag(ext.ResourceName, moduleName)
+	s.module.SetTag(constants.TestModule, moduleName)
+	testspan.Finish(s.module, s.moduleStatus, "", time.Time{})
+}
+
+// setUndelivered reports on the session the number of payloads that could not be delivered.
+func (s *session) setUndelivered(n int) {
+	if n > 0 {
+		s.span.SetTag(constants.TestUndeliveredPayloads, n)
+	}
+}
+
+// setGitUpload reports on the session the outcome of the upload of the git metadata.
+func (s *session) setGitUpload(result gitupload.Result) {
+	if result.Unshallow != "" {
+		s.span.SetTag(constants.GitUnshallow, result.Unshallow)
+	}
+}
+
+// finish finishes all the suites, the module and the session spans.
+func (s *session) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.finishModuleLocked()
+	testspan.Finish(s.span, s.status, "", time.Time{})
+}